@@ -0,0 +1,298 @@
+// Package api talks to the Paperframe API: which image is showing now, and
+// downloading images by ID.
+//
+// Every request has a timeout, so a connection that hangs can't stall the
+// service, and every response body is closed.
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client for the API at BaseURL, such as "https://paperframes.net/api".
+//
+// It remembers the ETag and Last-Modified of recent responses and makes
+// conditional requests with them, so polling for an ID that hasn't changed, or
+// fetching an image again, costs the server a 304 rather than a download.
+type Client struct {
+	BaseURL   string
+	UserAgent string
+	HTTP      *http.Client
+	Retry     RetryPolicy
+
+	// Called with a line about each retry, if set
+	Logf func(format string, v ...any)
+
+	mu    sync.Mutex
+	rand  *rand.Rand // For retry jitter
+	cache map[string]*cached
+	order []string // Paths in cache, least recently used first
+}
+
+// New makes a Client whose requests give up after timeout, identifying itself
+// with the client's version. Failed requests are retried per DefaultRetry.
+func New(baseURL string, timeout time.Duration, version string) *Client {
+	if version == "" {
+		version = "dev"
+	}
+
+	return &Client{
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		UserAgent: "paperframe/" + version,
+		HTTP:      &http.Client{Timeout: timeout},
+		Retry:     DefaultRetry,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// StatusError is returned when the API answers with anything but success.
+type StatusError struct {
+	Path       string
+	Code       int
+	RetryAfter time.Duration // How long the server asked to wait, if it did
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("api: %s: HTTP %d", e.Path, e.Code)
+}
+
+// A response kept for conditional requests: the validators the server sent
+// with it, and the body, which stands in for the next response if the server
+// says it's unchanged.
+type cached struct {
+	etag         string
+	lastModified string
+	contentType  string
+	body         []byte
+}
+
+// How many responses to keep. The current ID and the image showing are the
+// ones that matter; a few more covers flipping back to a recent image.
+const maxCached = 4
+
+// GET path (relative to BaseURL) with any extra headers and read the whole
+// body, retrying per c.Retry. Returns the body and its content type.
+func (c *Client) get(ctx context.Context, path string, header http.Header) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		// No use retrying a bad URL
+		return nil, "", fmt.Errorf("api: %s: %w", path, err)
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	for failures := 1; ; failures++ {
+		body, contentType, err := c.getOnce(req.Clone(ctx), path)
+		if err == nil || ctx.Err() != nil {
+			return body, contentType, err
+		}
+
+		c.mu.Lock()
+		r := c.rand.Float64()
+		c.mu.Unlock()
+
+		delay, ok := c.Retry.wait(err, failures, r)
+		if !ok {
+			return nil, "", err
+		}
+
+		if c.Logf != nil {
+			c.Logf("%s; retrying in %s", err, delay.Round(time.Millisecond))
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, "", fmt.Errorf("api: %s: %w", path, err)
+		}
+	}
+}
+
+// Make one GET request for path with req, a fresh copy of the request for
+// each attempt. If an earlier response had an ETag or Last-Modified, ask for
+// the body only if it has changed since; a 304 Not Modified gives the earlier
+// body.
+func (c *Client) getOnce(req *http.Request, path string) ([]byte, string, error) {
+	c.mu.Lock()
+	prev := c.cache[path]
+	c.mu.Unlock()
+
+	if prev != nil {
+		if prev.etag != "" {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+		if prev.lastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.lastModified)
+		}
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		// Some kind of networking error (we didn't even get an HTTP response)
+		return nil, "", fmt.Errorf("api: %s: %w", path, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified && prev != nil {
+		discard(res)
+
+		// The server may have sent fresher validators
+		entry := *prev
+		if etag := res.Header.Get("ETag"); etag != "" {
+			entry.etag = etag
+		}
+		if lastModified := res.Header.Get("Last-Modified"); lastModified != "" {
+			entry.lastModified = lastModified
+		}
+		c.remember(path, &entry)
+
+		return prev.body, prev.contentType, nil
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		discard(res)
+		return nil, "", &StatusError{
+			Path:       path,
+			Code:       res.StatusCode,
+			RetryAfter: retryAfter(res.Header, time.Now()),
+		}
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("api: %s: reading response: %w", path, err)
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	c.remember(path, &cached{
+		etag:         res.Header.Get("ETag"),
+		lastModified: res.Header.Get("Last-Modified"),
+		contentType:  contentType,
+		body:         body,
+	})
+
+	return body, contentType, nil
+}
+
+// Keep a response for conditional requests, if the server sent validators.
+func (c *Client) remember(path string, entry *cached) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry.etag == "" && entry.lastModified == "" {
+		c.forget(path)
+		return
+	}
+
+	if c.cache == nil {
+		c.cache = map[string]*cached{}
+	}
+
+	// Most recently used last
+	c.forget(path)
+	c.cache[path] = entry
+	c.order = append(c.order, path)
+
+	if len(c.order) > maxCached {
+		delete(c.cache, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// Drop a kept response. Requires c.mu.
+func (c *Client) forget(path string) {
+	if _, ok := c.cache[path]; !ok {
+		return
+	}
+
+	delete(c.cache, path)
+	for i, p := range c.order {
+		if p == path {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Read a little of what's left and close the body, so the connection can be
+// reused.
+func discard(res *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+	res.Body.Close()
+}
+
+// CurrentID fetches the ID of the image that should be showing now. The
+// panel's temperature in °C, or NaN if unknown, is sent along so the server
+// can keep an eye on frames in hot or cold spots.
+func (c *Client) CurrentID(ctx context.Context, temperature float64) (string, error) {
+	header := http.Header{}
+	if !math.IsNaN(temperature) {
+		header.Set("X-Panel-Temperature", strconv.FormatFloat(temperature, 'f', 1, 64))
+	}
+
+	id, _, err := c.get(ctx, "/now/id", header)
+	if err != nil {
+		return "", err
+	}
+
+	return string(id), nil
+}
+
+// Image downloads and decodes the image with the given ID.
+func (c *Client) Image(ctx context.Context, id string) (image.Image, error) {
+	path := "/image/" + id
+
+	body, contentType, err := c.get(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decodeImage(bytes.NewReader(body), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("api: %s: %w", path, err)
+	}
+
+	return img, nil
+}
+
+// Ping checks that the API can be reached and answers successfully.
+func (c *Client) Ping(ctx context.Context) error {
+	_, _, err := c.get(ctx, "", nil)
+	return err
+}
+
+// Decode GIF or JPEG image given a mimeType
+func decodeImage(data io.Reader, mimeType string) (image.Image, error) {
+	switch mimeType {
+	case "image/gif":
+		img, err := gif.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding GIF: %w", err)
+		}
+		return img, nil
+
+	case "image/jpg", "image/jpeg":
+		img, err := jpeg.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding JPEG: %w", err)
+		}
+		return img, nil
+
+	default:
+		return nil, errors.New("image type indeterminate or unsupported")
+	}
+}
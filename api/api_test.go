@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// An API with one image, "a", and a log of the requests it was sent.
+func newTestServer(t *testing.T) (*httptest.Server, *[]*http.Request) {
+	t.Helper()
+
+	var requests []*http.Request
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/now/id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a"))
+	})
+	mux.HandleFunc("/api/image/a", func(w http.ResponseWriter, r *http.Request) {
+		img := image.NewPaletted(image.Rect(0, 0, 4, 3), color.Palette{color.Black, color.White})
+		w.Header().Set("Content-Type", "image/gif")
+		gif.Encode(w, img, nil)
+	})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func TestCurrentID(t *testing.T) {
+	srv, requests := newTestServer(t)
+	c := New(srv.URL+"/api/", time.Second, "1.2.3")
+
+	id, err := c.CurrentID(context.Background(), 21.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "a" {
+		t.Errorf("CurrentID() = %q, want \"a\"", id)
+	}
+
+	r := (*requests)[0]
+	if got := r.Header.Get("User-Agent"); got != "paperframe/1.2.3" {
+		t.Errorf("User-Agent is %q", got)
+	}
+	if got := r.Header.Get("X-Panel-Temperature"); got != "21.2" {
+		t.Errorf("X-Panel-Temperature is %q, want 21.2", got)
+	}
+
+	if _, err := c.CurrentID(context.Background(), math.NaN()); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := (*requests)[1].Header["X-Panel-Temperature"]; ok {
+		t.Errorf("unknown temperature sent as %q", got)
+	}
+}
+
+func TestImage(t *testing.T) {
+	srv, _ := newTestServer(t)
+	c := New(srv.URL+"/api", time.Second, "")
+
+	img, err := c.Image(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 4, 3) {
+		t.Errorf("image is %v", img.Bounds())
+	}
+
+	_, err = c.Image(context.Background(), "b")
+	var status *StatusError
+	if !errors.As(err, &status) || status.Code != http.StatusNotFound {
+		t.Errorf("missing image gave %v, want a 404 StatusError", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	if err := New(srv.URL+"/api", time.Second, "").Ping(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if err := New(srv.URL+"/nothing", time.Second, "").Ping(context.Background()); err == nil {
+		t.Error("Ping should fail on a 404")
+	}
+}
+
+// A server that accepts the connection and never answers must not hang the
+// caller.
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	c := New(srv.URL, 50*time.Millisecond, "")
+	c.Retry.Attempts = 1
+
+	start := time.Now()
+	_, err := c.CurrentID(context.Background(), math.NaN())
+	if err == nil || !strings.Contains(err.Error(), "/now/id") {
+		t.Errorf("hung request gave %v, want a timeout error", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("took %s to give up", time.Since(start))
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	srv, _ := newTestServer(t)
+	c := New(srv.URL+"/api", time.Minute, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.CurrentID(ctx, math.NaN()); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled request gave %v, want context.Canceled", err)
+	}
+}
+
+// Serves "a" with the given validators, answering a bare 304 when the
+// request's conditional headers match them.
+func newConditionalServer(t *testing.T, etag, lastModified string) (*httptest.Server, *[]*http.Request) {
+	t.Helper()
+
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+
+		if (etag != "" && r.Header.Get("If-None-Match") == etag) ||
+			(lastModified != "" && r.Header.Get("If-Modified-Since") == lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		if lastModified != "" {
+			w.Header().Set("Last-Modified", lastModified)
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/image/") {
+			w.Header().Set("Content-Type", "image/gif")
+			gif.Encode(w, image.NewPaletted(image.Rect(0, 0, 4, 3), color.Palette{color.Black}), nil)
+			return
+		}
+		w.Write([]byte("a"))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func TestConditionalETag(t *testing.T) {
+	srv, requests := newConditionalServer(t, `"v1"`, "")
+	c := New(srv.URL, time.Second, "")
+
+	for i := 0; i < 3; i++ {
+		id, err := c.CurrentID(context.Background(), math.NaN())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != "a" {
+			t.Errorf("request %d: CurrentID() = %q, want \"a\"", i, id)
+		}
+	}
+
+	if got := (*requests)[0].Header.Get("If-None-Match"); got != "" {
+		t.Errorf("first request sent If-None-Match %q", got)
+	}
+	for i, r := range (*requests)[1:] {
+		if got := r.Header.Get("If-None-Match"); got != `"v1"` {
+			t.Errorf("request %d sent If-None-Match %q, want \"v1\"", i+1, got)
+		}
+	}
+}
+
+func TestConditionalLastModified(t *testing.T) {
+	lastModified := "Wed, 14 Oct 2026 09:00:00 GMT"
+	srv, requests := newConditionalServer(t, "", lastModified)
+	c := New(srv.URL, time.Second, "")
+
+	for i := 0; i < 3; i++ {
+		img, err := c.Image(context.Background(), "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds() != image.Rect(0, 0, 4, 3) {
+			t.Errorf("request %d: image is %v", i, img.Bounds())
+		}
+	}
+
+	// The 304s carry no validators of their own, so the first one must be kept
+	for i, r := range (*requests)[1:] {
+		if got := r.Header.Get("If-Modified-Since"); got != lastModified {
+			t.Errorf("request %d sent If-Modified-Since %q", i+1, got)
+		}
+	}
+}
+
+func TestConditionalNeedsValidators(t *testing.T) {
+	srv, requests := newTestServer(t)
+	c := New(srv.URL+"/api", time.Second, "")
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.CurrentID(context.Background(), math.NaN()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := (*requests)[1]
+	if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		t.Error("sent a conditional request without validators from the server")
+	}
+}
+
+func TestCacheIsBounded(t *testing.T) {
+	srv, _ := newConditionalServer(t, `"v1"`, "")
+	c := New(srv.URL, time.Second, "")
+
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		if _, err := c.Image(context.Background(), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(c.cache) != maxCached || len(c.order) != maxCached {
+		t.Errorf("kept %d responses (%d in order), want %d", len(c.cache), len(c.order), maxCached)
+	}
+	if _, ok := c.cache["/image/a"]; ok {
+		t.Error("oldest response wasn't dropped")
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy says how a Client retries a request that failed in a way that
+// may not happen again: a networking error, a timeout, or one of Statuses.
+// The wait doubles after each failure, from BaseDelay up to MaxDelay, and a
+// Retry-After from the server is honoured when it asks for longer.
+type RetryPolicy struct {
+	Attempts  int           // Tries in all, including the first
+	BaseDelay time.Duration // Wait after the first failure
+	MaxDelay  time.Duration // Longest wait, and longest Retry-After to wait out
+	Jitter    float64       // Fraction of each wait that's random, 0 to 1
+	Statuses  []int         // HTTP statuses worth trying again
+}
+
+// DefaultRetry rides out a minute or so of trouble, which also covers the
+// network coming up late at boot.
+var DefaultRetry = RetryPolicy{
+	Attempts:  6,
+	BaseDelay: 2 * time.Second,
+	MaxDelay:  time.Minute,
+	Jitter:    0.5,
+	Statuses: []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// The wait after the given number of failures, with r (from 0 to 1) picking
+// how much of the jitter to take off. Randomising the waits keeps frames that
+// lost the API together from all coming back at the same moment.
+func (p RetryPolicy) backoff(failures int, r float64) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(failures-1))
+	if limit := float64(p.MaxDelay); delay > limit {
+		delay = limit
+	}
+
+	return time.Duration(delay * (1 - p.Jitter*r))
+}
+
+// How long to wait before trying again after err, or false to give up.
+func (p RetryPolicy) wait(err error, failures int, r float64) (time.Duration, bool) {
+	if failures >= p.Attempts {
+		return 0, false
+	}
+
+	delay := p.backoff(failures, r)
+
+	var status *StatusError
+	if !errors.As(err, &status) {
+		// Networking errors and timeouts are always worth another go
+		return delay, true
+	}
+
+	retryable := false
+	for _, code := range p.Statuses {
+		if status.Code == code {
+			retryable = true
+		}
+	}
+	if !retryable {
+		return 0, false
+	}
+
+	if status.RetryAfter > p.MaxDelay {
+		// Not going to wait that long, and retrying sooner is no use
+		return 0, false
+	}
+	if status.RetryAfter > delay {
+		delay = status.RetryAfter
+	}
+
+	return delay, true
+}
+
+// Read a Retry-After header: a number of seconds, or an HTTP date. Zero if
+// there isn't one or it can't be read.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+
+	return 0
+}
+
+// Wait for d, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, Jitter: 0.5}
+
+	for _, c := range []struct {
+		failures int
+		r        float64
+		want     time.Duration
+	}{
+		{1, 0, time.Second},
+		{2, 0, 2 * time.Second},
+		{4, 0, 8 * time.Second},
+		{5, 0, 10 * time.Second}, // Capped
+		{2, 1, time.Second},      // Half of it is jitter
+		{5, 0.5, 7500 * time.Millisecond},
+	} {
+		if got := p.backoff(c.failures, c.r); got != c.want {
+			t.Errorf("backoff(%d, %v) = %s, want %s", c.failures, c.r, got, c.want)
+		}
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	p := RetryPolicy{Attempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Statuses: []int{503}}
+	network := errors.New("connection refused")
+
+	for _, c := range []struct {
+		name     string
+		err      error
+		failures int
+		want     time.Duration
+		ok       bool
+	}{
+		{"network", network, 1, time.Second, true},
+		{"out of attempts", network, 3, 0, false},
+		{"retryable status", &StatusError{Code: 503}, 2, 2 * time.Second, true},
+		{"other status", &StatusError{Code: 404}, 1, 0, false},
+		{"retry-after", &StatusError{Code: 503, RetryAfter: 30 * time.Second}, 1, 30 * time.Second, true},
+		{"short retry-after", &StatusError{Code: 503, RetryAfter: time.Millisecond}, 2, 2 * time.Second, true},
+		{"retry-after too long", &StatusError{Code: 503, RetryAfter: time.Hour}, 1, 0, false},
+	} {
+		got, ok := p.wait(c.err, c.failures, 0)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%s: wait = %s, %t; want %s, %t", c.name, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	for value, want := range map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-5":                            0,
+		"soon":                          0,
+		"Fri, 16 Oct 2026 09:00:30 GMT": 30 * time.Second,
+		"Fri, 16 Oct 2026 08:59:00 GMT": 0,
+	} {
+		header := http.Header{}
+		if value != "" {
+			header.Set("Retry-After", value)
+		}
+		if got := retryAfter(header, now); got != want {
+			t.Errorf("Retry-After %q = %s, want %s", value, got, want)
+		}
+	}
+}
+
+// A server that answers 503 the first `failures` times, with Retry-After if
+// given, then "a".
+func newFlakyServer(t *testing.T, failures int, retryAfter string) (*httptest.Server, *int) {
+	t.Helper()
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("a"))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func fastRetry() RetryPolicy {
+	p := DefaultRetry
+	p.BaseDelay = time.Millisecond
+	p.MaxDelay = 5 * time.Second
+	return p
+}
+
+func TestRetryRecovers(t *testing.T) {
+	srv, requests := newFlakyServer(t, 2, "")
+	c := New(srv.URL, time.Second, "")
+	c.Retry = fastRetry()
+
+	var logged int
+	c.Logf = func(string, ...any) { logged++ }
+
+	id, err := c.CurrentID(context.Background(), math.NaN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "a" || *requests != 3 || logged != 2 {
+		t.Errorf("got %q after %d requests and %d log lines, want \"a\" after 3 and 2", id, *requests, logged)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	srv, requests := newFlakyServer(t, 100, "")
+	c := New(srv.URL, time.Second, "")
+	c.Retry = fastRetry()
+	c.Retry.Attempts = 3
+
+	_, err := c.CurrentID(context.Background(), math.NaN())
+
+	var status *StatusError
+	if !errors.As(err, &status) || status.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %v, want the last 503", err)
+	}
+	if *requests != 3 {
+		t.Errorf("made %d requests, want 3", *requests)
+	}
+}
+
+func TestRetryHonoursRetryAfter(t *testing.T) {
+	srv, requests := newFlakyServer(t, 1, "1")
+	c := New(srv.URL, time.Second, "")
+	c.Retry = fastRetry()
+
+	start := time.Now()
+	if _, err := c.CurrentID(context.Background(), math.NaN()); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("retried after %s, before the server's Retry-After of 1s", waited)
+	}
+	if *requests != 2 {
+		t.Errorf("made %d requests, want 2", *requests)
+	}
+
+	// Asked to wait longer than MaxDelay: give up straight away
+	srv, requests = newFlakyServer(t, 1, "3600")
+	c.BaseURL = srv.URL
+	if _, err := c.CurrentID(context.Background(), math.NaN()); err == nil {
+		t.Error("should give up when Retry-After is past MaxDelay")
+	}
+	if *requests != 1 {
+		t.Errorf("made %d requests, want 1", *requests)
+	}
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+	srv, _ := newFlakyServer(t, 100, "")
+	c := New(srv.URL, time.Second, "")
+	c.Retry = fastRetry()
+	c.Retry.BaseDelay = time.Minute
+	c.Retry.MaxDelay = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.CurrentID(ctx, math.NaN())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("kept waiting %s after the context was done", time.Since(start))
+	}
+}
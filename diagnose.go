@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"tsmith512/epd7in5v2"
+)
+
+// Displays which can report on their controller, for "paperframe diagnose".
+type diagnoser interface {
+	Status(ctx context.Context) (epd7in5v2.Status, error)
+	Revision(ctx context.Context) ([]byte, error)
+}
+
+// Talk to the screen's controller and report what it says, to tell a wiring
+// or HAT fault (the controller doesn't answer) from a panel fault (it answers,
+// but the picture doesn't change). Returns the exit status.
+func diagnose(display Display) int {
+	fmt.Printf("Driver:      %s\n", DISPLAY_DRIVER)
+	fmt.Printf("Panel:       %s (%s)\n", DISPLAY_PANEL.Name, DISPLAY_PANEL.Model)
+
+	if display == nil {
+		fmt.Println("No screen to diagnose.")
+		return 1
+	}
+
+	d, ok := display.(diagnoser)
+	if !ok || !supports(display, epd7in5v2.FeatureSensor) {
+		fmt.Println("This display has no diagnostics.")
+		if DISPLAY_PANEL.Supports(epd7in5v2.FeatureSensor) {
+			fmt.Println("Reading from the controller needs display.spi_3wire or display.spi_miso.")
+		}
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DISPLAY_TIMEOUT)
+	defer cancel()
+
+	if err := display.Reset(); err != nil {
+		fmt.Printf("Reset:       failed: %s\n", err)
+		fmt.Println("\nCouldn't drive the GPIO pins. Is this running as root on a Pi?")
+		return 1
+	}
+	fmt.Println("Reset:       OK")
+
+	revision, err := d.Revision(ctx)
+	if err != nil {
+		fmt.Printf("Revision:    failed: %s\n", err)
+		fmt.Println("\nCouldn't use the SPI port. Is SPI enabled in raspi-config?")
+		return 1
+	}
+	answering := !silent(revision)
+	fmt.Printf("Revision:    % X\n", revision)
+
+	printStatus(ctx, d)
+
+	initErr := display.Init(ctx)
+	if initErr != nil {
+		fmt.Printf("Init:        failed: %s\n", initErr)
+	} else {
+		fmt.Println("Init:        OK")
+		printStatus(ctx, d)
+
+		if t, ok := display.(thermometer); ok && supports(display, epd7in5v2.FeatureSensor) {
+			if celsius, err := t.Temperature(ctx); err != nil {
+				fmt.Printf("Temperature: failed: %s\n", err)
+			} else {
+				fmt.Printf("Temperature: %.1f°C\n", celsius)
+			}
+		}
+
+		if err := display.Sleep(ctx); err != nil {
+			fmt.Printf("Sleep:       failed: %s\n", err)
+		}
+	}
+
+	fmt.Println()
+
+	switch {
+	case !answering && errors.Is(initErr, context.DeadlineExceeded):
+		fmt.Println("No reply from the controller and BUSY never cleared. Check the")
+		fmt.Println("ribbon cable and the HAT. If the HAT's data line is also wired to MISO,")
+		fmt.Println("set display.spi_miso = true instead of display.spi_3wire.")
+		return 1
+
+	case !answering:
+		fmt.Println("The panel powered on, but reads came back blank. Reads may not work")
+		fmt.Println("with this wiring (try display.spi_miso); the panel itself looks alive.")
+		return 0
+
+	case initErr != nil:
+		fmt.Println("The controller answers but didn't finish powering on. Suspect the")
+		fmt.Println("HAT's power circuit or the panel.")
+		return 1
+
+	default:
+		fmt.Println("The controller is answering and powers on. If the picture still doesn't")
+		fmt.Println("change, suspect the panel itself.")
+		return 0
+	}
+}
+
+func printStatus(ctx context.Context, d diagnoser) {
+	status, err := d.Status(ctx)
+	if err != nil {
+		fmt.Printf("Status:      failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Status:      %s (%#02x)\n", status, byte(status))
+}
+
+// Whether a reply is what an unconnected or shorted data line reads as.
+func silent(reply []byte) bool {
+	return len(bytes.Trim(reply, "\x00")) == 0 || len(bytes.Trim(reply, "\xff")) == 0
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"runtime"
+	"tsmith512/epd7in5v2"
+
+	"github.com/spf13/viper"
+)
+
+// Display is anything the service can paint a frame on: the e-paper panel
+// itself or a stand-in for development.
+//
+// Frame converts an image into the packed buffer the panel receives, which
+// Display then paints. The buffer belongs to the display and is reused by the
+// next Frame.
+//
+// Init, Display, Clear and Sleep wait on the hardware; they should give up and
+// return an error wrapping ctx.Err() once the context is done. Any failure to
+// talk to the hardware should be returned rather than ignored, so a bad
+// connection doesn't just look like a blank frame.
+type Display interface {
+	Init(ctx context.Context) error
+	Reset() error
+	Frame(img image.Image) []byte
+	Display(ctx context.Context, frame []byte) error
+	Clear(ctx context.Context) error
+	Sleep(ctx context.Context) error
+	Close() error
+	Bounds() image.Rectangle
+}
+
+// Displays which can show four shades of grey instead of black and white.
+type grayDisplay interface {
+	Init4Gray(ctx context.Context) error
+	Convert4Gray(img image.Image) (oldData, newData []byte)
+	Display4Gray(ctx context.Context, oldData, newData []byte) error
+}
+
+// Three-colour displays, which can show red as well as black and white.
+type redDisplay interface {
+	Convert3Color(img image.Image) (black, red []byte)
+	Display3Color(ctx context.Context, black, red []byte) error
+}
+
+// Displays with a quicker, lower quality waveform. Display after InitFast leaves
+// some ghosting, so a normal Init is needed every so often.
+type fastDisplay interface {
+	InitFast(ctx context.Context) error
+}
+
+// Displays which can run an anti-ghosting cycle, ending on a frame from Frame.
+type cleaner interface {
+	DeepCleanFrame(ctx context.Context, frame []byte) error
+}
+
+// Displays with a temperature sensor, whose waveforms can also be picked for a
+// given temperature instead of the reading.
+type thermometer interface {
+	Temperature(ctx context.Context) (float64, error)
+	ForceTemperature(ctx context.Context, celsius int) error
+}
+
+// Displays built for a particular panel, which may only have some of the
+// optional features above.
+type featured interface {
+	Supports(f epd7in5v2.Feature) bool
+}
+
+// Whether the display can use feature f, assuming it can if it doesn't say.
+// The driver has every method for every panel, so the interfaces above aren't
+// enough on their own.
+func supports(display Display, f epd7in5v2.Feature) bool {
+	if d, ok := display.(featured); ok {
+		return d.Supports(f)
+	}
+	return true
+}
+
+// Displays which can make use of the ID of the image being shown, such as the
+// simulator for naming its output files.
+type labeler interface {
+	SetLabel(label string)
+}
+
+// Read the [display] settings for how images are converted for the screen.
+func displayOptions() (epd7in5v2.Options, error) {
+	var opts epd7in5v2.Options
+	var err error
+
+	opts.Invert = viper.GetBool("display.invert")
+
+	opts.Rotation, err = epd7in5v2.ParseRotation(viper.GetInt("display.rotation"))
+	if err != nil {
+		return opts, err
+	}
+
+	opts.MirrorHorizontal = viper.GetBool("display.mirror_horizontal")
+	opts.MirrorVertical = viper.GetBool("display.mirror_vertical")
+
+	opts.Fit, err = epd7in5v2.ParseFit(viper.GetString("display.fit"))
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Gravity, err = epd7in5v2.ParseGravity(viper.GetString("display.gravity"))
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Dither, err = epd7in5v2.ParseDither(viper.GetString("display.dither"))
+	if err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// Read the [display] settings for how the panel is connected.
+func displayWiring() (epd7in5v2.Config, error) {
+	cfg := epd7in5v2.Config{
+		Model:     DISPLAY_PANEL.Model,
+		DC:        viper.GetString("display.pins.dc"),
+		CS:        viper.GetString("display.pins.cs"),
+		RST:       viper.GetString("display.pins.rst"),
+		BUSY:      viper.GetString("display.pins.busy"),
+		SPIPort:   viper.GetString("display.spi_port"),
+		ThreeWire: viper.GetBool("display.spi_3wire"),
+		MISO:      viper.GetBool("display.spi_miso"),
+	}
+
+	if err := cfg.SPISpeed.Set(viper.GetString("display.spi_speed")); err != nil {
+		return cfg, fmt.Errorf("Invalid display.spi_speed: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Pick and initialize a display backend by name (from `display.driver`), which
+// will prepare images using opts. Returns nil (and no error) when there is no
+// screen to drive.
+func newDisplay(driver string, opts epd7in5v2.Options) (Display, error) {
+	if driver == "auto" {
+		if runtime.GOARCH == "arm" {
+			driver = "epd"
+		} else {
+			log.Println("Skipping screen init: not running on compatible hardware")
+			return nil, nil
+		}
+	}
+
+	switch driver {
+	// "epd7in5v2" was the only panel before display.model
+	case "epd", "epd7in5v2":
+		cfg, err := displayWiring()
+		if err != nil {
+			return nil, err
+		}
+
+		epd, err := epd7in5v2.NewFromConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		epd.Options = opts
+		return epd, nil
+
+	case "simulator":
+		return newSimulator(SIMULATOR_DIR, DISPLAY_PANEL, opts)
+
+	case "none":
+		log.Println("Skipping screen init: no display driver selected")
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("Unknown display driver '%s'", driver)
+	}
+}
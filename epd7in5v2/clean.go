@@ -0,0 +1,41 @@
+package epd7in5v2
+
+import (
+	"bytes"
+	"context"
+	"image"
+)
+
+// DeepClean runs the anti-ghosting cycle panel makers recommend, ending on
+// img: the whole panel black, then white, then a negative of img, then img
+// itself. Driving every pixel to both extremes and back evens out charge left
+// behind by earlier images. It's four full refreshes, so it takes a while.
+// Requires Init.
+func (e *Epd) DeepClean(ctx context.Context, img image.Image) error {
+	return e.DeepCleanFrame(ctx, e.Frame(img))
+}
+
+// DeepCleanFrame is DeepClean for a frame already converted, such as one from
+// Frame. Requires Init.
+func (e *Epd) DeepCleanFrame(ctx context.Context, frame []byte) error {
+	for _, f := range CleanFrames(frame) {
+		if err := e.Display(ctx, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CleanFrames lists the buffers DeepClean paints, in order, for a frame from
+// Convert.
+func CleanFrames(frame []byte) [][]byte {
+	black := bytes.Repeat([]byte{Black.fill()}, len(frame))
+	white := bytes.Repeat([]byte{White.fill()}, len(frame))
+	negative := make([]byte, len(frame))
+	for i, b := range frame {
+		negative[i] = ^b
+	}
+
+	return [][]byte{black, white, negative, frame}
+}
@@ -0,0 +1,35 @@
+package epd7in5v2
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDeepClean(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	img := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	for x := 0; x < EPD_WIDTH/2; x++ {
+		for y := 0; y < EPD_HEIGHT; y++ {
+			img.SetGray(x, y, color.Gray{Y: 0xff})
+		}
+	}
+
+	if err := e.DeepClean(context.Background(), img); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "deep_clean", dump(r.transfers))
+
+	// Ends on the image, with the driver knowing that's what's on screen
+	frame := e.Convert(img)
+	if got := r.last(IMAGE_PROCESS); !bytes.Equal(got, frame) {
+		t.Error("last frame sent is not the image")
+	}
+	if !bytes.Equal(e.previous, frame) {
+		t.Error("previous frame is not the image")
+	}
+}
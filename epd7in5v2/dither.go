@@ -0,0 +1,225 @@
+package epd7in5v2
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// Dither selects how Convert reduces an image to the tones the panel can show.
+type Dither int
+
+const (
+	// Each pixel becomes the nearest tone. Fine for line art or images that
+	// were already dithered by the server; photos turn into blobs.
+	DitherNone Dither = iota
+
+	// Error diffusion: each pixel's rounding error is spread over neighbours
+	// that haven't been drawn yet.
+	DitherFloydSteinberg
+	DitherAtkinson // Spreads only 3/4 of the error: lighter, more contrast
+	DitherSierra   // Spreads over three rows: smoother, slightly softer
+
+	// Ordered dithering with an 8x8 Bayer matrix. Gives a regular crosshatch
+	// pattern that some prefer for illustrations.
+	DitherBayer
+)
+
+var ditherNames = map[Dither]string{
+	DitherNone:           "none",
+	DitherFloydSteinberg: "floyd-steinberg",
+	DitherAtkinson:       "atkinson",
+	DitherSierra:         "sierra",
+	DitherBayer:          "bayer",
+}
+
+func (d Dither) String() string {
+	if name, ok := ditherNames[d]; ok {
+		return name
+	}
+	return fmt.Sprintf("Dither(%d)", int(d))
+}
+
+// ParseDither looks up a dither mode by the name used in the config file.
+func ParseDither(name string) (Dither, error) {
+	for d, n := range ditherNames {
+		if n == name {
+			return d, nil
+		}
+	}
+	return DitherNone, fmt.Errorf("epd: unknown dither mode '%s'", name)
+}
+
+// One neighbour's share of a pixel's error: dx, dy from the current pixel,
+// and the weight (numerator over the kernel's divisor).
+type diffusion struct {
+	dx, dy, weight int
+}
+
+type kernel struct {
+	divisor int
+	spread  []diffusion
+}
+
+var kernels = map[Dither]kernel{
+	DitherFloydSteinberg: {16, []diffusion{
+		{1, 0, 7},
+		{-1, 1, 3}, {0, 1, 5}, {1, 1, 1},
+	}},
+	DitherAtkinson: {8, []diffusion{
+		{1, 0, 1}, {2, 0, 1},
+		{-1, 1, 1}, {0, 1, 1}, {1, 1, 1},
+		{0, 2, 1},
+	}},
+	DitherSierra: {32, []diffusion{
+		{1, 0, 5}, {2, 0, 3},
+		{-2, 1, 2}, {-1, 1, 4}, {0, 1, 5}, {1, 1, 4}, {2, 1, 2},
+		{-1, 2, 2}, {0, 2, 3}, {1, 2, 2},
+	}},
+}
+
+var bayer8 = [8][8]int{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// Read the image as luminance from 0 (black) to 1 (white), row-major, at its
+// own size. Returns the plane and its width and height.
+//
+// Going through img.At costs an interface call and an allocation per pixel,
+// which adds up on a Pi Zero, so the types the image decoders return are read
+// directly: *image.Gray (PNG), *image.Paletted (GIF) and *image.YCbCr (JPEG).
+// All give exactly the same plane as img.At would.
+func greyPlane(img image.Image) ([]float32, int, int) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	plane := make([]float32, w*h)
+
+	switch src := img.(type) {
+	case *image.Gray:
+		for j := 0; j < h; j++ {
+			row := src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+j):]
+			for i := 0; i < w; i++ {
+				plane[j*w+i] = float32(uint32(row[i])*0x101) / 0xffff
+			}
+		}
+
+	case *image.Paletted:
+		// Look each palette entry up once, rather than once per pixel
+		var lumas [256]float32
+		for k, c := range src.Palette {
+			if k < len(lumas) {
+				lumas[k] = luma(c)
+			}
+		}
+
+		for j := 0; j < h; j++ {
+			row := src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+j):]
+			for i := 0; i < w; i++ {
+				plane[j*w+i] = lumas[row[i]]
+			}
+		}
+
+	case *image.YCbCr:
+		for j := 0; j < h; j++ {
+			for i := 0; i < w; i++ {
+				x, y := bounds.Min.X+i, bounds.Min.Y+j
+				c := color.YCbCr{
+					Y:  src.Y[src.YOffset(x, y)],
+					Cb: src.Cb[src.COffset(x, y)],
+					Cr: src.Cr[src.COffset(x, y)],
+				}
+				r, g, b, _ := c.RGBA()
+				plane[j*w+i] = grey16(r, g, b)
+			}
+		}
+
+	case image.RGBA64Image:
+		// Still a call per pixel, but no allocation
+		for j := 0; j < h; j++ {
+			for i := 0; i < w; i++ {
+				c := src.RGBA64At(bounds.Min.X+i, bounds.Min.Y+j)
+				plane[j*w+i] = grey16(uint32(c.R), uint32(c.G), uint32(c.B))
+			}
+		}
+
+	default:
+		for j := 0; j < h; j++ {
+			for i := 0; i < w; i++ {
+				plane[j*w+i] = luma(img.At(bounds.Min.X+i, bounds.Min.Y+j))
+			}
+		}
+	}
+
+	return plane, w, h
+}
+
+// Luminance of a colour from 0 to 1, as color.Gray16Model has it.
+func luma(c color.Color) float32 {
+	return float32(color.Gray16Model.Convert(c).(color.Gray16).Y) / 0xffff
+}
+
+// The same, from 16-bit RGB components, as returned by RGBA.
+func grey16(r, g, b uint32) float32 {
+	y := (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+	return float32(uint16(y)) / 0xffff
+}
+
+// Reduce a grey plane (see greyPlane) to `levels` evenly spaced tones. Returns
+// each pixel's tone, from 0 (black) to levels-1 (white).
+func quantize(plane []float32, width, height, levels int, d Dither) []uint8 {
+	tones := make([]uint8, len(plane))
+	steps := float32(levels - 1)
+
+	nearest := func(v float32) uint8 {
+		t := int(v*steps + 0.5)
+		if t < 0 {
+			t = 0
+		} else if t > levels-1 {
+			t = levels - 1
+		}
+		return uint8(t)
+	}
+
+	k, diffuse := kernels[d]
+
+	// Error diffusion writes into the plane as it goes, so work on a copy
+	if diffuse {
+		plane = append([]float32(nil), plane...)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := plane[y*width+x]
+
+			if d == DitherBayer {
+				// Nudge each pixel by up to half a step either way before rounding
+				v += (float32(bayer8[y%8][x%8])+0.5)/64/steps - 0.5/steps
+			}
+
+			t := nearest(v)
+			tones[y*width+x] = t
+
+			if !diffuse {
+				continue
+			}
+
+			err := v - float32(t)/steps
+			for _, s := range k.spread {
+				nx, ny := x+s.dx, y+s.dy
+				if nx < 0 || nx >= width || ny >= height {
+					continue
+				}
+				plane[ny*width+nx] += err * float32(s.weight) / float32(k.divisor)
+			}
+		}
+	}
+
+	return tones
+}
@@ -0,0 +1,76 @@
+package epd7in5v2
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// Fraction of pixels that come out black
+func coverage(tones []uint8) float64 {
+	black := 0
+	for _, t := range tones {
+		if t == 0 {
+			black++
+		}
+	}
+	return float64(black) / float64(len(tones))
+}
+
+func TestDitherPreservesTone(t *testing.T) {
+	grey := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	draw.Draw(grey, grey.Bounds(), &image.Uniform{color.Gray{Y: 0x40}}, image.Point{}, draw.Src)
+	plane, _, _ := greyPlane(grey)
+
+	// 0x40 is 25% white, so roughly 75% of pixels should end up black
+	want := 1 - float64(0x40)/0xff
+
+	// Atkinson drops a quarter of the error, which pushes darker tones darker
+	tolerance := map[Dither]float64{
+		DitherFloydSteinberg: 0.02,
+		DitherAtkinson:       0.1,
+		DitherSierra:         0.02,
+		DitherBayer:          0.02,
+	}
+
+	for d, tol := range tolerance {
+		got := coverage(quantize(plane, EPD_WIDTH, EPD_HEIGHT, 2, d))
+		if math.Abs(got-want) > tol {
+			t.Errorf("%s: %.3f black, want %.3f ± %.2f", d, got, want, tol)
+		}
+	}
+
+	if got := coverage(quantize(plane, EPD_WIDTH, EPD_HEIGHT, 2, DitherNone)); got != 1 {
+		t.Errorf("none: %.3f black, want a solid fill", got)
+	}
+}
+
+func TestDitherLeavesBlackAndWhiteAlone(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(100, 100, 300, 200), image.Black, image.Point{}, draw.Src)
+
+	want := Convert(img, Options{Dither: DitherNone})
+
+	for _, d := range []Dither{DitherFloydSteinberg, DitherAtkinson, DitherSierra} {
+		got := Convert(img, Options{Dither: d})
+		if string(got) != string(want) {
+			t.Errorf("%s changed an image that was already black and white", d)
+		}
+	}
+}
+
+func TestParseDither(t *testing.T) {
+	for d, name := range ditherNames {
+		got, err := ParseDither(name)
+		if err != nil || got != d {
+			t.Errorf("ParseDither(%q) = %v, %v; want %v", name, got, err, d)
+		}
+	}
+
+	if _, err := ParseDither("stipple"); err == nil {
+		t.Error("ParseDither should reject unknown names")
+	}
+}
@@ -0,0 +1,78 @@
+package epd7in5v2
+
+import (
+	"context"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// The 4.2" panel, 400x300, with a UC8176 controller. Adapted from
+// https://github.com/waveshare/e-Paper/blob/master/RaspberryPi_JetsonNano/python/lib/waveshare_epd/epd4in2.py
+// but using the waveforms in OTP rather than uploading LUTs, as the 7.5" V2
+// does.
+var panel4in2 = &Panel{
+	Model:  "epd4in2",
+	Name:   `Waveshare 4.2" e-Paper`,
+	Width:  400,
+	Height: 300,
+
+	idle:       gpio.High,
+	initialize: (*Epd).init4in2,
+	display:    (*Epd).displayKW,
+	powerDown:  (*Epd).sleepKW,
+}
+
+func init() {
+	register(panel4in2)
+}
+
+func (e *Epd) init4in2(ctx context.Context) error {
+	if err := e.Reset(); err != nil {
+		return err
+	}
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	// Internal power, VDH/VDL = ±11V
+	if err := e.command(POWER_SETTING, 0x03, 0x00, 0x2B, 0x2B); err != nil {
+		return err
+	}
+	if err := e.command(BOOSTER_SOFT_START, 0x17, 0x17, 0x17); err != nil {
+		return err
+	}
+
+	if err := e.sendCommand(POWER_ON); err != nil {
+		return err
+	}
+	sleep(100 * time.Millisecond)
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	// 0 0 0 1 1 1 1 1
+	//     * LUT from OTP
+	//       * K/W Mode
+	//         * * * * Default values
+	if err := e.command(PANEL_SETTING, 0x1F); err != nil {
+		return err
+	}
+	// 50Hz
+	if err := e.command(PLL_CONTROL, 0x3C); err != nil {
+		return err
+	}
+	// 400x300
+	if err := e.command(TCON_RESOLUTION, 0x01, 0x90, 0x01, 0x2C); err != nil {
+		return err
+	}
+	if err := e.command(VCM_DC_SETTING, 0x28); err != nil {
+		return err
+	}
+
+	// 1 0 0 1 0 1 1 1
+	// * *             Border output: LUTW
+	//     * *         Data polarity (DDX) = 01: see Pixel
+	//         * * * * Default interval
+	return e.command(VCOM_AND_DATA_INTERVAL_SETTING, 0x97)
+}
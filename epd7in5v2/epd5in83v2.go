@@ -0,0 +1,70 @@
+package epd7in5v2
+
+import (
+	"context"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// The 5.83" V2 panel, 648x480. It has the same UC8179 controller as the 7.5"
+// V2, so the sensor readback works; the greyscale LUTs and fast and partial
+// modes haven't been tried on it. Adapted from
+// https://github.com/waveshare/e-Paper/blob/master/RaspberryPi_JetsonNano/python/lib/waveshare_epd/epd5in83_V2.py
+var panel5in83v2 = &Panel{
+	Model:    "epd5in83v2",
+	Name:     `Waveshare 5.83" e-Paper V2`,
+	Width:    648,
+	Height:   480,
+	Features: FeatureSensor,
+
+	idle:       gpio.High,
+	initialize: (*Epd).init5in83v2,
+	display:    (*Epd).displayKW,
+	powerDown:  (*Epd).sleepKW,
+}
+
+func init() {
+	register(panel5in83v2)
+}
+
+func (e *Epd) init5in83v2(ctx context.Context) error {
+	if err := e.Reset(); err != nil {
+		return err
+	}
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	// Internal power, VSH/VSL = ±15V
+	if err := e.command(POWER_SETTING, 0x07, 0x07, 0x3F, 0x3F); err != nil {
+		return err
+	}
+
+	if err := e.sendCommand(POWER_ON); err != nil {
+		return err
+	}
+	sleep(100 * time.Millisecond)
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	// K/W mode, LUT from OTP, as on the 7.5" V2
+	if err := e.command(PANEL_SETTING, 0x1F); err != nil {
+		return err
+	}
+	// 648x480
+	if err := e.command(TCON_RESOLUTION, 0x02, 0x88, 0x01, 0xE0); err != nil {
+		return err
+	}
+	if err := e.command(DUAL_SPI_MODE, 0x00); err != nil {
+		return err
+	}
+	// Data polarity (DDX) = 01 as on the 7.5" V2, where the Python example uses
+	// 0x10 and inverts the image instead: see Pixel
+	if err := e.command(VCOM_AND_DATA_INTERVAL_SETTING, 0x11, 0x07); err != nil {
+		return err
+	}
+
+	return e.command(TCON_SETTING, 0x22)
+}
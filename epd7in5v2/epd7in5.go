@@ -0,0 +1,109 @@
+package epd7in5v2
+
+import (
+	"context"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// The original 7.5" panel, 640x384, with a UC8159 controller. Adapted from
+// https://github.com/waveshare/e-Paper/blob/master/RaspberryPi_JetsonNano/python/lib/waveshare_epd/epd7in5.py
+var panel7in5 = &Panel{
+	Model:  "epd7in5",
+	Name:   `Waveshare 7.5" e-Paper (V1)`,
+	Width:  640,
+	Height: 384,
+
+	idle:       gpio.High,
+	initialize: (*Epd).init7in5,
+	display:    (*Epd).display7in5,
+	powerDown:  (*Epd).sleepKW,
+}
+
+func init() {
+	register(panel7in5)
+}
+
+func (e *Epd) init7in5(ctx context.Context) error {
+	if err := e.Reset(); err != nil {
+		return err
+	}
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	if err := e.command(POWER_SETTING, 0x37, 0x00); err != nil {
+		return err
+	}
+	if err := e.command(PANEL_SETTING, 0xCF, 0x08); err != nil {
+		return err
+	}
+	if err := e.command(BOOSTER_SOFT_START, 0xC7, 0xCC, 0x28); err != nil {
+		return err
+	}
+
+	if err := e.sendCommand(POWER_ON); err != nil {
+		return err
+	}
+	sleep(100 * time.Millisecond)
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	// 50Hz
+	if err := e.command(PLL_CONTROL, 0x3C); err != nil {
+		return err
+	}
+	// Internal temperature sensor
+	if err := e.command(TEMPERATURE_CALIBRATION, 0x00); err != nil {
+		return err
+	}
+	if err := e.command(VCOM_AND_DATA_INTERVAL_SETTING, 0x77); err != nil {
+		return err
+	}
+	if err := e.command(TCON_SETTING, 0x22); err != nil {
+		return err
+	}
+	// 640x384
+	if err := e.command(TCON_RESOLUTION, 0x02, 0x80, 0x01, 0x80); err != nil {
+		return err
+	}
+	if err := e.command(VCM_DC_SETTING, 0x1E); err != nil {
+		return err
+	}
+	// "Flash mode" in the Python example
+	return e.command(FORCE_TEMPERATURE, 0x03)
+}
+
+// The UC8159 takes four bits per pixel in a single buffer, from a palette
+// where 0x0 is black and 0x3 is white, and has no "old" data.
+func (e *Epd) display7in5(ctx context.Context, old, frame []byte) error {
+	wide := make([]byte, 0, len(frame)*4)
+
+	for _, b := range frame {
+		for bit := 7; bit > 0; bit -= 2 {
+			var pair byte
+			if b&(1<<bit) != 0 {
+				pair |= 0x30
+			}
+			if b&(1<<(bit-1)) != 0 {
+				pair |= 0x03
+			}
+			wide = append(wide, pair)
+		}
+	}
+
+	if err := e.sendCommand(DATA_START_TRANSMISSION_1); err != nil {
+		return err
+	}
+	if err := e.sendData2(wide); err != nil {
+		return err
+	}
+	if err := e.sendCommand(DISPLAY_REFRESH); err != nil {
+		return err
+	}
+	sleep(100 * time.Millisecond)
+
+	return e.waitUntilIdle(ctx)
+}
@@ -0,0 +1,84 @@
+package epd7in5v2
+
+import (
+	"context"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// The 7.5" B V2, 800x480 in black, white and red. It's the same UC8179 as the
+// 7.5" V2 in K/W/R mode, where the controller has no "old" data: see red.go.
+// Adapted from
+// https://github.com/waveshare/e-Paper/blob/master/RaspberryPi_JetsonNano/python/lib/waveshare_epd/epd7in5b_V2.py
+var panel7in5bv2 = &Panel{
+	Model:    "epd7in5bv2",
+	Name:     `Waveshare 7.5" e-Paper (B) V2`,
+	Width:    EPD_WIDTH,
+	Height:   EPD_HEIGHT,
+	Features: FeatureRed | FeatureSensor,
+
+	idle:       gpio.High,
+	initialize: (*Epd).init7in5bv2,
+	display:    (*Epd).displayKWR,
+	powerDown:  (*Epd).sleepKW,
+}
+
+func init() {
+	register(panel7in5bv2)
+}
+
+func (e *Epd) init7in5bv2(ctx context.Context) error {
+	if err := e.Reset(); err != nil {
+		return err
+	}
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	// Internal power, VSH/VSL = ±15V
+	if err := e.command(POWER_SETTING, 0x07, 0x07, 0x3F, 0x3F); err != nil {
+		return err
+	}
+	if err := e.command(BOOSTER_SOFT_START, 0x17, 0x17, 0x28, 0x17); err != nil {
+		return err
+	}
+
+	if err := e.sendCommand(POWER_ON); err != nil {
+		return err
+	}
+	sleep(100 * time.Millisecond)
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	// 0 0 0 0 1 1 1 1
+	//     * LUT from OTP
+	//       * K/W/R Mode: the red waveform
+	//         * * * * Default values
+	if err := e.command(PANEL_SETTING, 0x0F); err != nil {
+		return err
+	}
+	// 800x480
+	if err := e.command(TCON_RESOLUTION, 0x03, 0x20, 0x01, 0xE0); err != nil {
+		return err
+	}
+	if err := e.command(DUAL_SPI_MODE, 0x00); err != nil {
+		return err
+	}
+	// Data polarity (DDX) = 01: black plane 0 is black, red plane 1 is red
+	if err := e.command(VCOM_AND_DATA_INTERVAL_SETTING, 0x11, 0x07); err != nil {
+		return err
+	}
+	if err := e.command(TCON_SETTING, 0x22); err != nil {
+		return err
+	}
+
+	return e.command(SPI_FLASH_CONTROL, 0x00, 0x00, 0x00, 0x00)
+}
+
+// Display for controllers in K/W/R mode: a black and white frame is sent with
+// an empty red plane.
+func (e *Epd) displayKWR(ctx context.Context, old, frame []byte) error {
+	return e.paint3Color(ctx, frame, make([]byte, len(frame)))
+}
@@ -0,0 +1,144 @@
+package epd7in5v2
+
+import (
+	"context"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// The 7.5" HD panel uses an SSD1677 controller, which shares none of the
+// UC81xx commands above.
+const (
+	SSD_DRIVER_OUTPUT_CONTROL  byte = 0x01
+	SSD_BOOSTER_SOFT_START     byte = 0x0C
+	SSD_DEEP_SLEEP             byte = 0x10
+	SSD_DATA_ENTRY_MODE        byte = 0x11
+	SSD_SW_RESET               byte = 0x12
+	SSD_TEMPERATURE_SENSOR     byte = 0x18
+	SSD_MASTER_ACTIVATION      byte = 0x20
+	SSD_DISPLAY_UPDATE_CONTROL byte = 0x22
+	SSD_WRITE_RAM_BW           byte = 0x24
+	SSD_BORDER_WAVEFORM        byte = 0x3C
+	SSD_RAM_X_RANGE            byte = 0x44
+	SSD_RAM_Y_RANGE            byte = 0x45
+	SSD_AUTO_WRITE_RED_RAM     byte = 0x46
+	SSD_AUTO_WRITE_BW_RAM      byte = 0x47
+	SSD_RAM_X_ADDRESS_COUNTER  byte = 0x4E
+	SSD_RAM_Y_ADDRESS_COUNTER  byte = 0x4F
+)
+
+// The 7.5" HD panel, 880x528. Its BUSY pin is high while busy, the opposite
+// of the others. Adapted from
+// https://github.com/waveshare/e-Paper/blob/master/RaspberryPi_JetsonNano/python/lib/waveshare_epd/epd7in5_HD.py
+var panel7in5hd = &Panel{
+	Model:  "epd7in5hd",
+	Name:   `Waveshare 7.5" HD e-Paper`,
+	Width:  880,
+	Height: 528,
+
+	idle:       gpio.Low,
+	initialize: (*Epd).init7in5hd,
+	display:    (*Epd).display7in5hd,
+	powerDown:  (*Epd).sleep7in5hd,
+}
+
+func init() {
+	register(panel7in5hd)
+}
+
+func (e *Epd) init7in5hd(ctx context.Context) error {
+	if err := e.Reset(); err != nil {
+		return err
+	}
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	if err := e.commandAndWait(ctx, SSD_SW_RESET); err != nil {
+		return err
+	}
+
+	// Fill both RAMs, so nothing random shows on the first refresh
+	if err := e.commandAndWait(ctx, SSD_AUTO_WRITE_RED_RAM, 0xF7); err != nil {
+		return err
+	}
+	if err := e.commandAndWait(ctx, SSD_AUTO_WRITE_BW_RAM, 0xF7); err != nil {
+		return err
+	}
+
+	if err := e.command(SSD_BOOSTER_SOFT_START, 0xAE, 0xC7, 0xC3, 0xC0, 0x40); err != nil {
+		return err
+	}
+
+	// These are the Python example's values: it calls this "set MUX as 527"
+	if err := e.command(SSD_DRIVER_OUTPUT_CONTROL, 0xAF, 0x02, 0x01); err != nil {
+		return err
+	}
+
+	// Y decrements, X increments
+	if err := e.command(SSD_DATA_ENTRY_MODE, 0x01); err != nil {
+		return err
+	}
+	if err := e.command(SSD_RAM_X_RANGE, 0x00, 0x00, 0x6F, 0x03); err != nil {
+		return err
+	}
+	if err := e.command(SSD_RAM_Y_RANGE, 0xAF, 0x02, 0x00, 0x00); err != nil {
+		return err
+	}
+
+	if err := e.command(SSD_BORDER_WAVEFORM, 0x05); err != nil {
+		return err
+	}
+	// Internal temperature sensor
+	if err := e.command(SSD_TEMPERATURE_SENSOR, 0x80); err != nil {
+		return err
+	}
+
+	// Load the waveform for the temperature from OTP
+	if err := e.command(SSD_DISPLAY_UPDATE_CONTROL, 0xB1); err != nil {
+		return err
+	}
+	if err := e.commandAndWait(ctx, SSD_MASTER_ACTIVATION); err != nil {
+		return err
+	}
+
+	if err := e.command(SSD_RAM_X_ADDRESS_COUNTER, 0x00, 0x00); err != nil {
+		return err
+	}
+	return e.command(SSD_RAM_Y_ADDRESS_COUNTER, 0xAF, 0x02)
+}
+
+// The SSD1677 keeps the old frame itself, so only the new one is sent.
+func (e *Epd) display7in5hd(ctx context.Context, old, frame []byte) error {
+	if err := e.command(SSD_RAM_Y_ADDRESS_COUNTER, 0xAF, 0x02); err != nil {
+		return err
+	}
+
+	if err := e.sendCommand(SSD_WRITE_RAM_BW); err != nil {
+		return err
+	}
+	if err := e.sendData2(frame); err != nil {
+		return err
+	}
+
+	// Full update: clock on, load the waveform, run it, power down
+	if err := e.command(SSD_DISPLAY_UPDATE_CONTROL, 0xF7); err != nil {
+		return err
+	}
+	if err := e.sendCommand(SSD_MASTER_ACTIVATION); err != nil {
+		return err
+	}
+	sleep(100 * time.Millisecond)
+
+	return e.waitUntilIdle(ctx)
+}
+
+func (e *Epd) sleep7in5hd(ctx context.Context) error {
+	if err := e.command(SSD_DEEP_SLEEP, 0x01); err != nil {
+		return err
+	}
+	sleep(100 * time.Millisecond)
+
+	return nil
+}
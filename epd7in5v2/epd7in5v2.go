@@ -17,15 +17,18 @@
 // His version was for the now discontinued HD display 880x528 with 16-shade
 // greyscale, but I don't think I'll have to make too many changes.
 // (Famous last words...)
+//
+// Other Waveshare panels are supported too, each described by a Panel and
+// selected by model name: see Models and NewFromConfig. The package keeps its
+// name because the 7.5" V2 is still the default and the best supported.
 
 package epd7in5v2
 
 import (
-	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"image"
-	"image/color"
-	"log"
 	"time"
 
 	"periph.io/x/conn/v3"
@@ -81,15 +84,70 @@ const (
 	AUTO_MEASUREMENT_VCOM          byte = 0x80
 	READ_VCOM_VALUE                byte = 0x81
 	VCM_DC_SETTING                 byte = 0x82
+	PARTIAL_WINDOW                 byte = 0x90
+	PARTIAL_IN                     byte = 0x91
+	PARTIAL_OUT                    byte = 0x92
+	CASCADE_SETTING                byte = 0xE0
+	FORCE_TEMPERATURE              byte = 0xE5
+)
+
+// Pixel is the value of one bit in a packed frame. Init sets the controller's
+// data polarity (DDX in VCOM_AND_DATA_INTERVAL_SETTING) to the datasheet
+// default for K/W mode, so a 0 bit is black and a 1 bit is white, in both the
+// old (DATA_START_TRANSMISSION_1) and new (IMAGE_PROCESS) buffers.
+type Pixel byte
+
+const (
+	Black Pixel = 0
+	White Pixel = 1
 )
 
+// A byte of eight pixels of this color.
+func (p Pixel) fill() byte {
+	if p == White {
+		return 0xFF
+	}
+	return 0x00
+}
+
 // Yanked from the Python example, I don't know what this is yet.
 var VOLTAGE_FRAME_7IN5_V2 = [7]byte{
 	0x6, 0x3F, 0x3F, 0x11, 0x24, 0x7, 0x17,
 }
 
+// The 7.5" V2, which this package was written for and which has every feature.
+var panel7in5v2 = &Panel{
+	Model:    "epd7in5v2",
+	Name:     `Waveshare 7.5" e-Paper V2`,
+	Width:    EPD_WIDTH,
+	Height:   EPD_HEIGHT,
+	Features: FeatureGray | FeatureFast | FeaturePartial | FeatureSensor,
+
+	idle:       gpio.High,
+	initialize: (*Epd).init7in5v2,
+	display:    (*Epd).displayKW,
+	powerDown:  (*Epd).sleepKW,
+}
+
+func init() {
+	register(panel7in5v2)
+}
+
+// Waiting on the BUSY pin: how long to block on an edge before re-checking,
+// and how often to poll the pin when edges aren't supported.
+const (
+	busyEdgeTimeout  = 100 * time.Millisecond
+	busyPollInterval = 10 * time.Millisecond
+)
+
+// Pauses between steps of the controller's sequences. Swapped out in tests so
+// they don't spend minutes waiting on a panel that isn't there.
+var sleep = time.Sleep
+
 // Epd is a handle to the display controller.
 type Epd struct {
+	panel      *Panel
+	port       spi.PortCloser
 	c          conn.Conn
 	dc         gpio.PinOut
 	cs         gpio.PinOut
@@ -97,18 +155,86 @@ type Epd struct {
 	busy       gpio.PinIO
 	widthByte  int
 	heightByte int
+	cmd        byte   // Last command sent, for error messages
+	previous   []byte // Copy of the last frame displayed, which is the "old" data for the next
+	fast       bool   // Set up by InitFast rather than Init
+	asleep     bool   // In deep sleep, ignoring everything but a reset
+	readable   bool   // Wired so the controller's replies can be read
+	closed     bool
+
+	// Show's frame buffer
+	frame []byte
+
+	// How Convert and Show prepare images for this panel
+	Options Options
 }
 
-// New returns a Epd object that communicates over SPI to the display controller.
+// Config describes which panel is connected and how it's wired up.
+type Config struct {
+	// Panel model, from Models()
+	Model string
+
+	// GPIO pins, by any name periph.io knows them by: header position
+	// ("P1_22") or GPIO number ("GPIO25")
+	DC, CS, RST, BUSY string
+
+	// SPI port, such as "/dev/spidev0.0" or "SPI0.0". Empty for the first one.
+	SPIPort string
+
+	// SPI clock. Zero for the default 4MHz.
+	SPISpeed physic.Frequency
+
+	// The controller's one data line is normally wired to MOSI only, as on
+	// Waveshare's HAT, so the panel is driven write-only and the features that
+	// read it back (Temperature, Status, Revision) are unavailable. Set
+	// ThreeWire to read on the same line in 3-wire SPI mode, where the SPI
+	// controller and kernel support it. Set MISO instead for boards that also
+	// wire the line to MISO.
+	ThreeWire bool
+	MISO      bool
+}
+
+// DefaultConfig is Waveshare's HAT on a Raspberry Pi. See the pinout at
+// https://www.waveshare.com/wiki/7.5inch_e-Paper_HAT_Manual#Hardware_connection
+var DefaultConfig = Config{
+	Model:    "epd7in5v2",
+	DC:       "P1_22",
+	CS:       "P1_24",
+	RST:      "P1_11",
+	BUSY:     "P1_18",
+	SPISpeed: 4 * physic.MegaHertz,
+}
+
+// New returns a Epd object that communicates over SPI to the display controller
+// of a 7.5" V2 panel. The SPI settings are from DefaultConfig; see
+// NewFromConfig to change them or use another panel.
 func New(dcPin, csPin, rstPin, busyPin string) (*Epd, error) {
+	cfg := DefaultConfig
+	cfg.DC, cfg.CS, cfg.RST, cfg.BUSY = dcPin, csPin, rstPin, busyPin
+
+	return NewFromConfig(cfg)
+}
+
+// NewFromConfig is New with the wiring and SPI settings in cfg.
+func NewFromConfig(cfg Config) (*Epd, error) {
+	model := cfg.Model
+	if model == "" {
+		model = DefaultConfig.Model
+	}
+
+	panel, err := LookupPanel(model)
+	if err != nil {
+		return nil, err
+	}
+
 	if _, err := host.Init(); err != nil {
 		return nil, err
 	}
 
 	// DC pin
-	dc := gpioreg.ByName(dcPin)
+	dc := gpioreg.ByName(cfg.DC)
 	if dc == nil {
-		return nil, errors.New("spi: failed to find DC pin")
+		return nil, fmt.Errorf("spi: failed to find DC pin '%s'", cfg.DC)
 	}
 
 	if dc == gpio.INVALID {
@@ -120,9 +246,9 @@ func New(dcPin, csPin, rstPin, busyPin string) (*Epd, error) {
 	}
 
 	// CS pin
-	cs := gpioreg.ByName(csPin)
+	cs := gpioreg.ByName(cfg.CS)
 	if cs == nil {
-		return nil, errors.New("spi: failed to find CS pin")
+		return nil, fmt.Errorf("spi: failed to find CS pin '%s'", cfg.CS)
 	}
 
 	if err := cs.Out(gpio.Low); err != nil {
@@ -130,9 +256,9 @@ func New(dcPin, csPin, rstPin, busyPin string) (*Epd, error) {
 	}
 
 	// RST pin
-	rst := gpioreg.ByName(rstPin)
+	rst := gpioreg.ByName(cfg.RST)
 	if rst == nil {
-		return nil, errors.New("spi: failed to find RST pin")
+		return nil, fmt.Errorf("spi: failed to find RST pin '%s'", cfg.RST)
 	}
 
 	if err := rst.Out(gpio.Low); err != nil {
@@ -140,38 +266,48 @@ func New(dcPin, csPin, rstPin, busyPin string) (*Epd, error) {
 	}
 
 	// BUSY pin
-	busy := gpioreg.ByName(busyPin)
+	busy := gpioreg.ByName(cfg.BUSY)
 	if busy == nil {
-		return nil, errors.New("spi: failed to find BUSY pin")
+		return nil, fmt.Errorf("spi: failed to find BUSY pin '%s'", cfg.BUSY)
 	}
 
-	if err := busy.In(gpio.PullDown, gpio.RisingEdge); err != nil {
+	// Watch for the controller going idle
+	edge := gpio.RisingEdge
+	if panel.idle == gpio.Low {
+		edge = gpio.FallingEdge
+	}
+
+	if err := busy.In(gpio.PullDown, edge); err != nil {
 		return nil, err
 	}
 
 	// SPI
-	port, err := spireg.Open("")
+	port, err := spireg.Open(cfg.SPIPort)
 	if err != nil {
 		return nil, err
 	}
 
-	c, err := port.Connect(4*physic.MegaHertz, spi.Mode0, 8)
-	if err != nil {
-		port.Close()
-		return nil, err
+	speed := cfg.SPISpeed
+	if speed == 0 {
+		speed = DefaultConfig.SPISpeed
 	}
 
-	var widthByte, heightByte int
+	mode := spi.Mode0
+	if cfg.ThreeWire && !cfg.MISO {
+		mode |= spi.HalfDuplex
+	}
 
-	if EPD_WIDTH%8 == 0 {
-		widthByte = (EPD_WIDTH / 8)
-	} else {
-		widthByte = (EPD_WIDTH/8 + 1)
+	c, err := port.Connect(speed, mode, 8)
+	if err != nil {
+		port.Close()
+		return nil, err
 	}
 
-	heightByte = EPD_HEIGHT
+	widthByte, heightByte := panel.bufferSize()
 
 	e := &Epd{
+		panel:      panel,
+		port:       port,
 		c:          c,
 		dc:         dc,
 		cs:         cs,
@@ -179,43 +315,91 @@ func New(dcPin, csPin, rstPin, busyPin string) (*Epd, error) {
 		busy:       busy,
 		widthByte:  widthByte,
 		heightByte: heightByte,
+		readable:   cfg.ThreeWire || cfg.MISO,
+		// Held in reset until Init, so there's nothing to put to sleep yet
+		asleep: true,
 	}
 
 	return e, nil
 }
 
 // Reset / Wake Up
-func (e *Epd) Reset() {
-	e.rst.Out(gpio.High)
-	time.Sleep(200 * time.Millisecond)
-	e.rst.Out(gpio.Low)
-	time.Sleep(200 * time.Millisecond)
-	e.rst.Out(gpio.High)
-	time.Sleep(200 * time.Millisecond)
+func (e *Epd) Reset() error {
+	for _, level := range []gpio.Level{gpio.High, gpio.Low, gpio.High} {
+		if err := e.rst.Out(level); err != nil {
+			return fmt.Errorf("epd: reset: %w", err)
+		}
+		sleep(200 * time.Millisecond)
+	}
+
+	e.asleep = false
+	return nil
 }
 
 // Send Command Byte
-func (e *Epd) sendCommand(cmd byte) {
-	e.dc.Out(gpio.Low)
-	e.cs.Out(gpio.Low)
-	e.c.Tx([]byte{cmd}, nil)
-	e.cs.Out(gpio.High)
+func (e *Epd) sendCommand(cmd byte) error {
+	e.cmd = cmd
+
+	if err := e.write(gpio.Low, []byte{cmd}); err != nil {
+		return fmt.Errorf("epd: command 0x%02X: %w", cmd, err)
+	}
+
+	return nil
 }
 
 // Send Data Byte, one at a time
-func (e *Epd) sendData(data byte) {
-	// log.Println("sendData")
-	e.dc.Out(gpio.High)
-	e.cs.Out(gpio.Low)
-	e.c.Tx([]byte{data}, nil)
-	e.cs.Out(gpio.High)
+func (e *Epd) sendData(data byte) error {
+	if err := e.write(gpio.High, []byte{data}); err != nil {
+		return fmt.Errorf("epd: data for command 0x%02X: %w", e.cmd, err)
+	}
+
+	return nil
 }
 
 // Send Data Bytearray, chunked by block.
 // (Useful for large payloads. See Python dev examples and spidev.writebytes2())
-func (e *Epd) sendData2(data []byte) {
-	e.dc.Out(gpio.High)
-	e.cs.Out(gpio.Low)
+func (e *Epd) sendData2(data []byte) error {
+	if err := e.write(gpio.High, data); err != nil {
+		return fmt.Errorf("epd: data for command 0x%02X: %w", e.cmd, err)
+	}
+
+	return nil
+}
+
+// Send a command followed by its parameters, one byte at a time.
+func (e *Epd) command(cmd byte, data ...byte) error {
+	if err := e.sendCommand(cmd); err != nil {
+		return err
+	}
+
+	for _, b := range data {
+		if err := e.sendData(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Send a command and its parameters, then wait for the controller to finish.
+func (e *Epd) commandAndWait(ctx context.Context, cmd byte, data ...byte) error {
+	if err := e.command(cmd, data...); err != nil {
+		return err
+	}
+
+	return e.waitUntilIdle(ctx)
+}
+
+// Select the controller, set DC (low for a command, high for data) and clock
+// the bytes out in blocks of at most 4096.
+func (e *Epd) write(dc gpio.Level, data []byte) error {
+	if err := e.dc.Out(dc); err != nil {
+		return err
+	}
+
+	if err := e.cs.Out(gpio.Low); err != nil {
+		return err
+	}
 
 	length := len(data)
 	blocksize := 4096
@@ -224,179 +408,364 @@ func (e *Epd) sendData2(data []byte) {
 		end := start + blocksize
 
 		if end > length {
-			e.c.Tx(data[start:length], nil)
-		} else {
-			e.c.Tx(data[start:end], nil)
+			end = length
 		}
+
+		if err := e.c.Tx(data[start:end], nil); err != nil {
+			// Still release CS so the next transfer starts clean
+			e.cs.Out(gpio.High)
+			return err
+		}
+	}
+
+	return e.cs.Out(gpio.High)
+}
+
+// Read n bytes of the controller's reply to the last command.
+func (e *Epd) read(n int) ([]byte, error) {
+	reply := make([]byte, n)
+
+	if err := e.dc.Out(gpio.High); err != nil {
+		return nil, err
+	}
+	if err := e.cs.Out(gpio.Low); err != nil {
+		return nil, err
 	}
 
-	e.cs.Out(gpio.High)
+	if err := e.c.Tx(nil, reply); err != nil {
+		e.cs.Out(gpio.High)
+		return nil, fmt.Errorf("epd: reading reply to command 0x%02X: %w", e.cmd, err)
+	}
+
+	return reply, e.cs.Out(gpio.High)
 }
 
-// Pause until display is ready. NB: busy pin is _high_ when idle!
-func (e *Epd) waitUntilIdle() {
-	for e.busy.Read() == gpio.Low {
-		log.Println("Still waiting for idle...")
-		time.Sleep(1000 * time.Millisecond)
+// Pause until display is ready. NB: on most panels the busy pin is _high_ when
+// idle! See Panel.idle.
+// Gives up with an error wrapping ctx.Err() once the context is done, so a
+// panel stuck busy can be reset instead of hanging forever.
+func (e *Epd) waitUntilIdle(ctx context.Context) error {
+	for e.busy.Read() != e.panel.idle {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("epd: gave up waiting for idle: %w", err)
+		}
+
+		// New() asked for edges on BUSY towards the idle level, so sleep until
+		// one arrives. Time out regularly to re-check the
+		// level and the context in case an edge was missed.
+		start := time.Now()
+		if !e.busy.WaitForEdge(busyEdgeTimeout) && time.Since(start) < busyEdgeTimeout {
+			// Returned early without an edge: edge detection isn't available on
+			// this pin, so fall back to polling.
+			time.Sleep(busyPollInterval)
+		}
 	}
+
+	return nil
 }
 
 // Init and power on display from sleep.
-func (e *Epd) Init() {
+func (e *Epd) Init(ctx context.Context) error {
+	e.fast = false
+	return e.panel.initialize(e, ctx)
+}
+
+// Init for the 7.5" V2.
+func (e *Epd) init7in5v2(ctx context.Context) error {
 	// log.Println("   - Reset")
-	e.Reset()
-	e.waitUntilIdle()
+	if err := e.Reset(); err != nil {
+		return err
+	}
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
 
 	// log.Println("   - Send Power Settings")
-	e.sendCommand(POWER_SETTING)
-	e.sendData(0x17)                     // 1-0=11 internal power
-	e.sendData(VOLTAGE_FRAME_7IN5_V2[6]) // VGH&VGL
-	e.sendData(VOLTAGE_FRAME_7IN5_V2[1]) // VSH
-	e.sendData(VOLTAGE_FRAME_7IN5_V2[2]) // VSL
-	e.sendData(VOLTAGE_FRAME_7IN5_V2[3]) // VSHR
-	e.waitUntilIdle()
+	err := e.commandAndWait(ctx, POWER_SETTING,
+		0x17,                     // 1-0=11 internal power
+		VOLTAGE_FRAME_7IN5_V2[6], // VGH&VGL
+		VOLTAGE_FRAME_7IN5_V2[1], // VSH
+		VOLTAGE_FRAME_7IN5_V2[2], // VSL
+		VOLTAGE_FRAME_7IN5_V2[3], // VSHR
+	)
+	if err != nil {
+		return err
+	}
 
 	// log.Println("   - VCM DC")
-	e.sendCommand(VCM_DC_SETTING)
-	e.sendData(VOLTAGE_FRAME_7IN5_V2[0])
-	e.waitUntilIdle()
+	if err := e.commandAndWait(ctx, VCM_DC_SETTING, VOLTAGE_FRAME_7IN5_V2[0]); err != nil {
+		return err
+	}
 
 	// log.Println("   - Booster Soft Start")
-	e.sendCommand(BOOSTER_SOFT_START)
-	e.sendData(0x27)
-	e.sendData(0x27)
-	e.sendData(0x2F)
-	e.sendData(0x17)
-	e.waitUntilIdle()
+	if err := e.commandAndWait(ctx, BOOSTER_SOFT_START, 0x27, 0x27, 0x2F, 0x17); err != nil {
+		return err
+	}
 
 	// log.Println("   - PLL Control")
-	e.sendCommand(PLL_CONTROL)
 	// Python example called 0x30 "OSC Setting" but it is the PLL clock freq.
-	e.sendData(VOLTAGE_FRAME_7IN5_V2[0]) // 0110 = 50Hz.
-	e.waitUntilIdle()
+	// 0110 = 50Hz.
+	if err := e.commandAndWait(ctx, PLL_CONTROL, VOLTAGE_FRAME_7IN5_V2[0]); err != nil {
+		return err
+	}
 
 	// log.Println("   - Display Power On")
-	e.sendCommand(POWER_ON)
-	time.Sleep(100 * time.Millisecond)
-	e.waitUntilIdle()
+	if err := e.sendCommand(POWER_ON); err != nil {
+		return err
+	}
+	sleep(100 * time.Millisecond)
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
 
 	// log.Println("   - Panel Setting")
-	e.sendCommand(PANEL_SETTING)
-	e.sendData(0x1F)
 	// 0 0 0 1 1 1 1 1
 	//     * LUT from OTP so we don't have to send it
 	//       * K/W Mode (i.e. black and white, this isn't a red-capable panel)
 	//         * * * * Default values
-	e.waitUntilIdle()
+	if err := e.commandAndWait(ctx, PANEL_SETTING, 0x1F); err != nil {
+		return err
+	}
 
 	// log.Println("   - Resolution Setting")
-	e.sendCommand(TCON_RESOLUTION)
-	e.sendData(0x03)
-	e.sendData(0x20)
-	e.sendData(0x01)
-	e.sendData(0xE0)
 	// Not sure how 800x480 is encoded described in this.
-	e.waitUntilIdle()
+	if err := e.commandAndWait(ctx, TCON_RESOLUTION, 0x03, 0x20, 0x01, 0xE0); err != nil {
+		return err
+	}
 
 	// log.Println("   - Set Dual SPI Mode")
-	e.sendCommand(DUAL_SPI_MODE)
-	e.sendData(0x00)
 	// Set as DISABLED
-	e.waitUntilIdle()
+	if err := e.commandAndWait(ctx, DUAL_SPI_MODE, 0x00); err != nil {
+		return err
+	}
 
 	// log.Println("   - VCOM and DATA")
-	e.sendCommand(VCOM_AND_DATA_INTERVAL_SETTING)
-	e.sendData(0x10)
-	e.sendData(0x07)
-	e.waitUntilIdle()
+	// 0 0 0 1 0 0 0 1
+	//     * *         Border output: LUTW
+	//               * Data polarity (DDX) = 01, the datasheet default: see Pixel
+	// The Python example uses 0x10 (DDX = 00) which inverts every bit, so
+	// 0 draws white. That's why earlier versions had to flip their palette.
+	if err := e.commandAndWait(ctx, VCOM_AND_DATA_INTERVAL_SETTING, 0x11, 0x07); err != nil {
+		return err
+	}
 
 	// log.Println("   - TCON Setting")
-	e.sendCommand(TCON_SETTING)
-	e.sendData(0x22)
-	e.waitUntilIdle()
+	if err := e.commandAndWait(ctx, TCON_SETTING, 0x22); err != nil {
+		return err
+	}
 
 	// log.Println("   - Gate/Source Start Setting")
-	e.sendCommand(SPI_FLASH_CONTROL) // But Python called 0x65 "Resolution setting"
-	// And yes, this is exactly what the Python did, with the comment on the 2nd line
-	// I think this is related to rotation...
-	e.sendData(0x00)
-	e.sendData(0x00) // 800*480
-	e.sendData(0x00)
-	e.sendData(0x00)
-	e.waitUntilIdle()
+	// But Python called 0x65 "Resolution setting"
+	// And yes, this is exactly what the Python did, with the comment on the 2nd
+	// byte "800*480". I think this is related to rotation...
+	if err := e.commandAndWait(ctx, SPI_FLASH_CONTROL, 0x00, 0x00, 0x00, 0x00); err != nil {
+		return err
+	}
+
 	// log.Println("   Init Complete")
+	return nil
 }
 
 // Clears the screen to white.
-// @TODO: Per the docs, 0=black, 1=white, but this works: 0 is white. :confused:
-func (e *Epd) Clear() {
-	bytes := bytes.Repeat([]byte{0x00}, e.heightByte*e.widthByte)
-	e.sendCommand(DATA_START_TRANSMISSION_1)
-	e.sendData2(bytes)
-	e.sendCommand(DATA_STOP)
-	e.sendCommand(IMAGE_PROCESS)
-	e.sendData2(bytes)
-	e.sendCommand(DATA_STOP)
-	e.sendCommand(DISPLAY_REFRESH)
-	time.Sleep(5 * time.Second)
-	e.waitUntilIdle()
-}
-
-// Paint a prepared bitmap in a bytearray to the screen.
-func (e *Epd) Display(img []byte) {
-	e.sendCommand(IMAGE_PROCESS)
-	e.sendData2(img)
-	e.sendCommand(DATA_STOP)
-	e.sendCommand(DISPLAY_REFRESH)
-	time.Sleep(5 * time.Second)
-	e.waitUntilIdle()
+func (e *Epd) Clear(ctx context.Context) error {
+	return e.Display(ctx, e.panel.Blank())
+}
+
+// Paint a prepared bitmap in a bytearray to the screen. The driver keeps its
+// own copy of img, so the caller is free to reuse it afterwards.
+func (e *Epd) Display(ctx context.Context, img []byte) error {
+	old := e.previous
+	if old == nil {
+		// Don't know what's on screen; assume it was cleared
+		old = e.panel.Blank()
+	}
+
+	if err := e.panel.display(e, ctx, old, img); err != nil {
+		return err
+	}
+
+	// Reuse the last copy's storage rather than allocating a frame each time
+	e.previous = append(e.previous[:0], img...)
+	return nil
+}
+
+// Display for controllers in K/W mode (UC8179, UC8176). Per the datasheet,
+// the controller takes the frame already on screen as "old" data and the one
+// to show as "new" data, so both are sent.
+func (e *Epd) displayKW(ctx context.Context, old, img []byte) error {
+	if err := e.sendFrame(DATA_START_TRANSMISSION_1, old); err != nil {
+		return err
+	}
+	if err := e.sendFrame(IMAGE_PROCESS, img); err != nil {
+		return err
+	}
+	if err := e.sendCommand(DISPLAY_REFRESH); err != nil {
+		return err
+	}
+	if e.fast {
+		sleep(100 * time.Millisecond)
+	} else {
+		sleep(5 * time.Second)
+	}
+
+	return e.waitUntilIdle(ctx)
+}
+
+// Send a whole frame to one of the controller's buffers.
+func (e *Epd) sendFrame(cmd byte, frame []byte) error {
+	if err := e.sendCommand(cmd); err != nil {
+		return err
+	}
+	if err := e.sendData2(frame); err != nil {
+		return err
+	}
+	return e.sendCommand(DATA_STOP)
 }
 
 // Sleep the display in power-saving mode.
 // Use Init() to wake up and initialize the display.
-func (e *Epd) Sleep() {
-	e.sendCommand(POWER_OFF)
-	e.waitUntilIdle()
-	e.sendCommand(DEEP_SLEEP)
-	e.sendData(0xA5)
-	time.Sleep(2 * time.Second)
+func (e *Epd) Sleep(ctx context.Context) error {
+	if err := e.panel.powerDown(e, ctx); err != nil {
+		return err
+	}
+
+	e.asleep = true
+	return nil
 }
 
-// Convert the input image into bitmap as a ready-to-display B&W bytearray.
-// @TODO: Per the docs, 0=black, 1=white, but this works: 0 is white. :confused:
-func (e *Epd) Convert(img image.Image) []byte {
-	var byteToSend byte = 0x00
-	var bgColor = 1
-
-	buffer := bytes.Repeat([]byte{0x00}, e.widthByte*e.heightByte)
-
-	// Iterate through individual device pixel coords by col within row:
-	for j := 0; j < EPD_HEIGHT; j++ {
-		for i := 0; i < EPD_WIDTH; i++ {
-			bit := bgColor
-
-			// Check that the device pixel we're on is within the image canvas
-			if i < img.Bounds().Dx() && j < img.Bounds().Dy() {
-				// I flipped this from the original Go pallete. This uses [white=0, black=1]
-				// because images were inverted. Something is getting inverted somewhere...
-				bit = color.Palette([]color.Color{color.White, color.Black}).Index(img.At(i, j))
-			}
-
-			// These two statements do a bitwise shift and OR to pack 8 pixels (as
-			// individual bits) into a single byte to send to the display.
-			if bit == 1 {
-				byteToSend |= 0x80 >> (uint32(i) % 8)
-				// Compound operator: `x |= y` is the same as `x = x | y`
-				// and the >> is a bitwise right shift
-			}
-
-			// If we're on the last pixel in a byte, save the byte and move on
-			if i%8 == 7 {
-				buffer[(i/8)+(j*e.widthByte)] = byteToSend
-				byteToSend = 0x00
-			}
+// Sleep for UC81xx controllers.
+func (e *Epd) sleepKW(ctx context.Context) error {
+	if err := e.commandAndWait(ctx, POWER_OFF); err != nil {
+		return err
+	}
+	if err := e.command(DEEP_SLEEP, 0xA5); err != nil {
+		return err
+	}
+	sleep(2 * time.Second)
+
+	return nil
+}
+
+// Show converts an image and paints it to the screen. It converts into a
+// buffer it keeps rather than allocating a new frame each time.
+func (e *Epd) Show(ctx context.Context, img image.Image) error {
+	return e.Display(ctx, e.Frame(img))
+}
+
+// Frame converts an image into Show's buffer, ready for Display, so the frame
+// can be checked before it's painted. The buffer is reused by the next Frame
+// or Show.
+func (e *Epd) Frame(img image.Image) []byte {
+	e.frame = e.panel.ConvertInto(e.frame, img, e.Options)
+	return e.frame
+}
+
+// Bounds of the drawable area in device pixels.
+func (e *Epd) Bounds() image.Rectangle {
+	return e.panel.Bounds()
+}
+
+// Panel is the model of panel this Epd drives.
+func (e *Epd) Panel() *Panel {
+	return e.panel
+}
+
+// Supports reports whether the panel has all of the features in f, and is
+// wired for them. FeatureSensor needs Config.ThreeWire or Config.MISO.
+func (e *Epd) Supports(f Feature) bool {
+	if f&FeatureSensor != 0 && !e.readable {
+		return false
+	}
+	return e.panel.Supports(f)
+}
+
+// Check the panel has an optional feature before using it.
+func (e *Epd) require(f Feature) error {
+	if !e.panel.Supports(f) {
+		return fmt.Errorf("epd: %s panel has no %s", e.panel.Model, f)
+	}
+	return nil
+}
+
+// Check the panel has a sensor and its replies can be read.
+func (e *Epd) requireReads() error {
+	if err := e.require(FeatureSensor); err != nil {
+		return err
+	}
+	if !e.readable {
+		return errors.New("epd: reads need 3-wire SPI or MISO wired (see Config)")
+	}
+	return nil
+}
+
+// How long Close waits for the panel to power off before giving up on it.
+const closeTimeout = 10 * time.Second
+
+// Close puts the panel to sleep if it isn't already, drives RST, DC and CS low
+// so nothing is left powered or floating, and releases the SPI port. The Epd
+// can't be used afterwards; closing it again does nothing.
+func (e *Epd) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	var errs []error
+
+	if !e.asleep {
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		errs = append(errs, e.Sleep(ctx))
+		cancel()
+	}
+
+	for _, pin := range []gpio.PinOut{e.rst, e.dc, e.cs} {
+		errs = append(errs, pin.Out(gpio.Low))
+	}
+
+	// Stop watching for edges
+	errs = append(errs, e.busy.Halt())
+
+	if e.port != nil {
+		errs = append(errs, e.port.Close())
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("epd: close: %w", err)
 		}
 	}
 
-	return buffer
+	return nil
+}
+
+// Options for turning images into frames for the panel.
+type Options struct {
+	Invert           bool // Swap black and white, for a negative image
+	Rotation         Rotation
+	MirrorHorizontal bool // Flip left-right, before rotating
+	MirrorVertical   bool // Flip top-bottom, before rotating
+	Fit              Fit
+	Gravity          Gravity
+	Dither           Dither
+}
+
+// Convert the input image into bitmap as a ready-to-display B&W bytearray,
+// using the Epd's Options.
+func (e *Epd) Convert(img image.Image) []byte {
+	return e.panel.Convert(img, e.Options)
+}
+
+// Convert the input image into bitmap for the 7.5" V2. See Panel.Convert.
+func Convert(img image.Image, opts Options) []byte {
+	return panel7in5v2.Convert(img, opts)
+}
+
+// Blank returns a packed frame for the 7.5" V2 that is entirely white.
+func Blank() []byte {
+	return panel7in5v2.Blank()
+}
+
+// Unpack a bitmap for the 7.5" V2. See Panel.Unpack.
+func Unpack(buffer []byte) *image.Paletted {
+	return panel7in5v2.Unpack(buffer)
 }
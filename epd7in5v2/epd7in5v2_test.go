@@ -0,0 +1,472 @@
+package epd7in5v2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"strings"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+)
+
+func TestInit(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	if err := e.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "init", dump(r.transfers))
+
+	if e.rst.(gpio.PinIO).Read() != gpio.High {
+		t.Error("RST should be released (high) after Init")
+	}
+}
+
+func TestClear(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	if err := e.Clear(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "clear", dump(r.transfers))
+}
+
+func TestDisplay(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	// White canvas with a black square in the top-left corner
+	img := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 16, 16), image.Black, image.Point{}, draw.Src)
+
+	if err := e.Display(context.Background(), e.Convert(img)); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "display", dump(r.transfers))
+
+	// New data: rows are packed MSB-first, 8 pixels per byte, 100 bytes per
+	// row, 0 for black and 1 for white.
+	frame := r.last(IMAGE_PROCESS)
+	for _, row := range []int{0, 15} {
+		got := frame[row*100 : row*100+3]
+		if got[0] != 0x00 || got[1] != 0x00 || got[2] != 0xFF {
+			t.Errorf("row %d starts % X, want 00 00 FF", row, got)
+		}
+	}
+	if frame[16*100] != 0xFF {
+		t.Errorf("row 16 starts %02X, want FF", frame[16*100])
+	}
+}
+
+func TestWhiteImageIsWhite(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	img := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	if err := e.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Display(context.Background(), e.Convert(img)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Golden file shows the controller set to the datasheet's polarity (DDX = 01,
+	// 1 is white) and both old and new buffers all 1s.
+	assertGolden(t, "display_white", dump(r.transfers))
+
+	frame := Unpack(r.last(IMAGE_PROCESS))
+	for j := 0; j < EPD_HEIGHT; j++ {
+		for i := 0; i < EPD_WIDTH; i++ {
+			if frame.At(i, j) != color.White {
+				t.Fatalf("pixel (%d, %d) would show %v", i, j, frame.At(i, j))
+			}
+		}
+	}
+}
+
+func TestInvert(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for i, b := range Convert(img, Options{Invert: true}) {
+		if b != 0x00 {
+			t.Fatalf("byte %d is %02X, inverted white should be black (00)", i, b)
+		}
+	}
+}
+
+func TestClearIsWhite(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	if err := e.Clear(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tr := range r.transfers {
+		if tr.cmd == DATA_START_TRANSMISSION_1 || tr.cmd == IMAGE_PROCESS {
+			if !bytes.Equal(tr.data, bytes.Repeat([]byte{0xFF}, len(tr.data))) {
+				t.Errorf("%s is not all white", commandNames[tr.cmd])
+			}
+		}
+	}
+}
+
+func TestSleep(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	if err := e.Sleep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "sleep", dump(r.transfers))
+}
+
+func TestClose(t *testing.T) {
+	e, r := newTestEpd(t)
+	ctx := context.Background()
+
+	if err := e.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	r.transfers = nil
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Still awake, so it's put to sleep first
+	assertGolden(t, "sleep", dump(r.transfers))
+
+	for name, pin := range map[string]gpio.PinIO{"RST": e.rst.(gpio.PinIO), "DC": e.dc.(gpio.PinIO), "CS": e.cs.(gpio.PinIO)} {
+		if pin.Read() != gpio.Low {
+			t.Errorf("%s left high", name)
+		}
+	}
+
+	// Closing again does nothing
+	r.transfers = nil
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.transfers) != 0 {
+		t.Errorf("second Close sent %d commands", len(r.transfers))
+	}
+}
+
+func TestCloseAfterSleep(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	if err := e.Sleep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	r.transfers = nil
+
+	// The controller ignores commands in deep sleep, so don't wait on it
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.transfers) != 0 {
+		t.Errorf("Close sent %d commands to a sleeping panel", len(r.transfers))
+	}
+}
+
+func TestCloseBeforeInit(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	// Opened but never woken: the controller is still held in reset
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.transfers) != 0 {
+		t.Errorf("Close sent %d commands to a panel that was never initialised", len(r.transfers))
+	}
+}
+
+func TestInitBusyTimeout(t *testing.T) {
+	e, _ := newTestEpd(t)
+
+	// Panel never comes back from busy
+	e.busy.Out(gpio.Low)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := e.Init(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Init() = %v, want deadline exceeded", err)
+	}
+}
+
+func TestWaitForBusyEdge(t *testing.T) {
+	e, _ := newTestEpd(t)
+	busy := e.busy.(*gpiotest.Pin)
+	busy.Out(gpio.Low)
+
+	// Controller finishes shortly after we start waiting
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		busy.EdgesChan <- gpio.High
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := e.waitUntilIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > busyEdgeTimeout {
+		t.Errorf("waitUntilIdle took %s, should wake on the edge", elapsed)
+	}
+}
+
+func TestInitTxErrors(t *testing.T) {
+	cases := []struct {
+		failAt int
+		want   string
+	}{
+		{1, "epd: command 0x01: "},
+		{2, "epd: data for command 0x01: "},
+		{7, "epd: command 0x82: "},
+	}
+
+	for _, c := range cases {
+		e, r := newTestEpd(t)
+		r.failAt = c.failAt
+
+		err := e.Init(context.Background())
+		if !errors.Is(err, errLoose) {
+			t.Fatalf("failing Tx #%d: Init() = %v, want %v", c.failAt, err, errLoose)
+		}
+		if !strings.HasPrefix(err.Error(), c.want) {
+			t.Errorf("failing Tx #%d: error %q should start with %q", c.failAt, err, c.want)
+		}
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	img.Set(0, 0, color.Black)
+	img.Set(9, 3, color.Black)
+	img.Set(EPD_WIDTH-1, EPD_HEIGHT-1, color.Black)
+
+	frame := Unpack(Convert(img, Options{}))
+
+	for j := 0; j < EPD_HEIGHT; j++ {
+		for i := 0; i < EPD_WIDTH; i++ {
+			want := img.GrayAt(i, j).Y == 0
+			got := frame.ColorIndexAt(i, j) == uint8(Black)
+			if got != want {
+				t.Fatalf("pixel (%d, %d): black = %t, want %t", i, j, got, want)
+			}
+		}
+	}
+}
+
+// Hides the concrete type, so greyPlane has to take the generic path.
+type opaqueImage struct {
+	image.Image
+}
+
+// Test images of each type greyPlane has a fast path for, as decoded from a
+// PNG, GIF and JPEG, at the panel's size so fit has nothing to do.
+func convertTestImages() map[string]image.Image {
+	bounds := image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT)
+
+	gray := image.NewGray(bounds)
+	paletted := image.NewPaletted(bounds, palette.Plan9)
+	ycbcr := image.NewYCbCr(bounds, image.YCbCrSubsampleRatio420)
+
+	for y := 0; y < EPD_HEIGHT; y++ {
+		for x := 0; x < EPD_WIDTH; x++ {
+			c := color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 0xFF}
+			gray.Set(x, y, c)
+			paletted.Set(x, y, c)
+
+			yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+			ycbcr.Y[ycbcr.YOffset(x, y)] = yy
+			ycbcr.Cb[ycbcr.COffset(x, y)] = cb
+			ycbcr.Cr[ycbcr.COffset(x, y)] = cr
+		}
+	}
+
+	return map[string]image.Image{
+		"gray":     gray,
+		"paletted": paletted,
+		"ycbcr":    ycbcr,
+	}
+}
+
+// The fast paths must give exactly what img.At would.
+func TestConvertFastPaths(t *testing.T) {
+	for name, img := range convertTestImages() {
+		// Off the origin too, as a SubImage would be
+		sub := img.(interface {
+			SubImage(image.Rectangle) image.Image
+		}).SubImage(image.Rect(13, 7, 613, 407))
+
+		for _, img := range []image.Image{img, sub} {
+			want, ww, wh := greyPlane(opaqueImage{img})
+			got, gw, gh := greyPlane(img)
+
+			if gw != ww || gh != wh {
+				t.Fatalf("%s: plane is %dx%d, want %dx%d", name, gw, gh, ww, wh)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("%s %v: pixel %d is %v, want %v", name, img.Bounds(), i, got[i], want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestConvertIntoReusesBuffer(t *testing.T) {
+	img := convertTestImages()["gray"]
+
+	dst := bytes.Repeat([]byte{0xAA}, EPD_WIDTH*EPD_HEIGHT/8)
+
+	frame := panel7in5v2.ConvertInto(dst, img, Options{})
+	if &frame[0] != &dst[0] {
+		t.Error("ConvertInto allocated instead of reusing dst")
+	}
+	if !bytes.Equal(frame, Convert(img, Options{})) {
+		t.Error("ConvertInto into a dirty buffer differs from Convert")
+	}
+}
+
+func BenchmarkConvert(b *testing.B) {
+	for name, img := range convertTestImages() {
+		for _, c := range []struct {
+			path    string
+			convert func(dst []byte, img image.Image) []byte
+		}{
+			{"fast", func(dst []byte, img image.Image) []byte {
+				return panel7in5v2.ConvertInto(dst, img, Options{})
+			}},
+			{"generic", func(dst []byte, img image.Image) []byte {
+				return panel7in5v2.ConvertInto(dst, opaqueImage{img}, Options{})
+			}},
+			{"baseline", func(dst []byte, img image.Image) []byte {
+				return baselineConvert(img)
+			}},
+		} {
+			b.Run(name+"/"+c.path, func(b *testing.B) {
+				b.ReportAllocs()
+				var frame []byte
+				for i := 0; i < b.N; i++ {
+					frame = c.convert(frame, img)
+				}
+			})
+		}
+	}
+}
+
+// Convert as it was before dithering, fitting and the fast paths: a palette
+// lookup through img.At for every pixel, and no scaling. Kept to benchmark
+// against.
+func baselineConvert(img image.Image) []byte {
+	var byteToSend byte = 0x00
+	var bgColor = 1
+
+	widthByte := EPD_WIDTH / 8
+	buffer := bytes.Repeat([]byte{0x00}, widthByte*EPD_HEIGHT)
+	palette := color.Palette([]color.Color{color.White, color.Black})
+
+	for j := 0; j < EPD_HEIGHT; j++ {
+		for i := 0; i < EPD_WIDTH; i++ {
+			bit := bgColor
+
+			if i < img.Bounds().Dx() && j < img.Bounds().Dy() {
+				bit = palette.Index(img.At(i, j))
+			}
+
+			if bit == 1 {
+				byteToSend |= 0x80 >> (uint32(i) % 8)
+			}
+
+			if i%8 == 7 {
+				buffer[(i/8)+(j*widthByte)] = byteToSend
+				byteToSend = 0x00
+			}
+		}
+	}
+
+	return buffer
+}
+
+// Show reuses its buffers, but must still send the frame on screen as the old
+// data each time.
+func TestShowReusesFrames(t *testing.T) {
+	e, r := newTestEpd(t)
+	ctx := context.Background()
+
+	black := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	white := image.NewGray(black.Bounds())
+	draw.Draw(white, white.Bounds(), image.White, image.Point{}, draw.Src)
+
+	var first *byte
+	for i, img := range []image.Image{black, white, black, white} {
+		r.transfers = nil
+		if err := e.Show(ctx, img); err != nil {
+			t.Fatal(err)
+		}
+
+		want, old := byte(0x00), byte(0xFF)
+		if i%2 == 1 {
+			want, old = old, want
+		}
+		if i == 0 {
+			// Nothing known on screen yet: assumed blank
+			old = 0xFF
+		}
+
+		if got := r.last(IMAGE_PROCESS); got[0] != want {
+			t.Errorf("Show #%d sent new data %02X, want %02X", i, got[0], want)
+		}
+		if got := r.last(DATA_START_TRANSMISSION_1); got[0] != old {
+			t.Errorf("Show #%d sent old data %02X, want %02X", i, got[0], old)
+		}
+
+		if i == 0 {
+			first = &e.previous[0]
+		}
+		if i == 2 && &e.previous[0] != first {
+			t.Error("Show allocated a new frame instead of reusing its buffers")
+		}
+	}
+}
+
+// Frame converts into Show's buffer, and Display paints it as Show would.
+func TestFrame(t *testing.T) {
+	e, r := newTestEpd(t)
+	img := convertTestImages()["gray"]
+
+	frame := e.Frame(img)
+	if !bytes.Equal(frame, e.Convert(img)) {
+		t.Error("Frame differs from Convert")
+	}
+	if again := e.Frame(img); &again[0] != &frame[0] {
+		t.Error("Frame allocated instead of reusing its buffer")
+	}
+
+	if err := e.Display(context.Background(), frame); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.last(IMAGE_PROCESS); !bytes.Equal(got, frame) {
+		t.Error("Display did not send the frame")
+	}
+}
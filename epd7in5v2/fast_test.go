@@ -0,0 +1,52 @@
+package epd7in5v2
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInitFast(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	if err := e.InitFast(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "init_fast", dump(r.transfers))
+}
+
+func TestFastRefreshDelay(t *testing.T) {
+	e, _ := newTestEpd(t)
+	ctx := context.Background()
+
+	var longest time.Duration
+	sleep = func(d time.Duration) {
+		if d > longest {
+			longest = d
+		}
+	}
+
+	if err := e.InitFast(ctx); err != nil {
+		t.Fatal(err)
+	}
+	longest = 0
+	if err := e.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if longest > time.Second {
+		t.Errorf("fast refresh slept %s", longest)
+	}
+
+	// A normal Init goes back to the full waveform and delay
+	if err := e.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	longest = 0
+	if err := e.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if longest < time.Second {
+		t.Errorf("full refresh only slept %s", longest)
+	}
+}
@@ -0,0 +1,294 @@
+package epd7in5v2
+
+import (
+	"fmt"
+	"math"
+)
+
+// Fit selects how an image that isn't exactly panel-sized is made to fit.
+type Fit int
+
+const (
+	FitContain Fit = iota // Scale to fit inside the panel, padding with white
+	FitCover              // Scale to fill the panel, cropping the overflow
+	FitStretch            // Scale each axis to the panel, ignoring aspect ratio
+	FitNone               // Draw at original size, cropping or padding as needed
+)
+
+var fitNames = map[Fit]string{
+	FitContain: "contain",
+	FitCover:   "cover",
+	FitStretch: "stretch",
+	FitNone:    "none",
+}
+
+func (f Fit) String() string {
+	if name, ok := fitNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Fit(%d)", int(f))
+}
+
+// ParseFit looks up a fit mode by the name used in the config file.
+func ParseFit(name string) (Fit, error) {
+	for f, n := range fitNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return FitContain, fmt.Errorf("epd: unknown fit mode '%s'", name)
+}
+
+// Gravity selects which part of the panel an image is anchored to when it is
+// padded (contain, none), or which part of the image is kept when it is
+// cropped (cover, none).
+type Gravity int
+
+const (
+	GravityCenter Gravity = iota
+	GravityTop
+	GravityBottom
+	GravityLeft
+	GravityRight
+	GravityTopLeft
+	GravityTopRight
+	GravityBottomLeft
+	GravityBottomRight
+)
+
+var gravityNames = map[Gravity]string{
+	GravityCenter:      "center",
+	GravityTop:         "top",
+	GravityBottom:      "bottom",
+	GravityLeft:        "left",
+	GravityRight:       "right",
+	GravityTopLeft:     "top-left",
+	GravityTopRight:    "top-right",
+	GravityBottomLeft:  "bottom-left",
+	GravityBottomRight: "bottom-right",
+}
+
+func (g Gravity) String() string {
+	if name, ok := gravityNames[g]; ok {
+		return name
+	}
+	return fmt.Sprintf("Gravity(%d)", int(g))
+}
+
+// ParseGravity looks up a gravity by the name used in the config file.
+func ParseGravity(name string) (Gravity, error) {
+	for g, n := range gravityNames {
+		if n == name {
+			return g, nil
+		}
+	}
+	return GravityCenter, fmt.Errorf("epd: unknown gravity '%s'", name)
+}
+
+// Where along each axis the image sits: 0 is the top/left edge, 1 the
+// bottom/right edge.
+func (g Gravity) anchor() (x, y float64) {
+	x, y = 0.5, 0.5
+
+	switch g {
+	case GravityTop, GravityTopLeft, GravityTopRight:
+		y = 0
+	case GravityBottom, GravityBottomLeft, GravityBottomRight:
+		y = 1
+	}
+
+	switch g {
+	case GravityLeft, GravityTopLeft, GravityBottomLeft:
+		x = 0
+	case GravityRight, GravityTopRight, GravityBottomRight:
+		x = 1
+	}
+
+	return x, y
+}
+
+// Scale and position a grey plane (see greyPlane) of size w x h onto a new
+// width x height canvas according to the fit mode and gravity. Anything not
+// covered by the image is white.
+func fit(plane []float32, w, h, width, height int, f Fit, g Gravity) []float32 {
+	if w == 0 || h == 0 {
+		return blank(width, height)
+	}
+
+	// Size of the image once scaled
+	dw, dh := w, h
+
+	switch f {
+	case FitContain, FitCover:
+		sx := float64(width) / float64(w)
+		sy := float64(height) / float64(h)
+
+		scale := math.Min(sx, sy)
+		if f == FitCover {
+			scale = math.Max(sx, sy)
+		}
+
+		dw = int(math.Round(float64(w) * scale))
+		dh = int(math.Round(float64(h) * scale))
+
+	case FitStretch:
+		dw, dh = width, height
+	}
+
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	if dw != w || dh != h {
+		plane = resample(plane, w, h, dw, dh)
+	}
+
+	if dw == width && dh == height {
+		return plane
+	}
+
+	// Offset of the scaled image on the canvas. Negative means it's cropped.
+	ax, ay := g.anchor()
+	ox := int(math.Round(float64(width-dw) * ax))
+	oy := int(math.Round(float64(height-dh) * ay))
+
+	canvas := blank(width, height)
+
+	for y := 0; y < height; y++ {
+		sy := y - oy
+		if sy < 0 || sy >= dh {
+			continue
+		}
+
+		for x := 0; x < width; x++ {
+			sx := x - ox
+			if sx < 0 || sx >= dw {
+				continue
+			}
+
+			canvas[y*width+x] = plane[sy*dw+sx]
+		}
+	}
+
+	return canvas
+}
+
+// A white width x height grey plane.
+func blank(width, height int) []float32 {
+	plane := make([]float32, width*height)
+	for i := range plane {
+		plane[i] = 1
+	}
+	return plane
+}
+
+// Catmull-Rom cubic: sharp, without the ringing of windowed sinc filters.
+func catmullRom(x float64) float64 {
+	x = math.Abs(x)
+
+	switch {
+	case x < 1:
+		return (1.5*x-2.5)*x*x + 1
+	case x < 2:
+		return ((-0.5*x+2.5)*x-4)*x + 2
+	default:
+		return 0
+	}
+}
+
+// One source sample contributing to a destination sample.
+type tap struct {
+	index  int
+	weight float32
+}
+
+// Work out which source samples feed each destination sample when scaling
+// one axis from srcLen to dstLen. When shrinking, the filter is widened so
+// every source sample contributes.
+func taps(srcLen, dstLen int) [][]tap {
+	scale := float64(srcLen) / float64(dstLen)
+	filterScale := math.Max(scale, 1)
+	support := 2 * filterScale
+
+	result := make([][]tap, dstLen)
+
+	for d := range result {
+		center := (float64(d)+0.5)*scale - 0.5
+		lo := int(math.Ceil(center - support))
+		hi := int(math.Floor(center + support))
+
+		var sum float64
+		var row []tap
+
+		for s := lo; s <= hi; s++ {
+			w := catmullRom((float64(s) - center) / filterScale)
+			if w == 0 {
+				continue
+			}
+
+			// Repeat the edge pixels rather than fading to black past them
+			i := s
+			if i < 0 {
+				i = 0
+			} else if i >= srcLen {
+				i = srcLen - 1
+			}
+
+			row = append(row, tap{i, float32(w)})
+			sum += w
+		}
+
+		for i := range row {
+			row[i].weight /= float32(sum)
+		}
+
+		result[d] = row
+	}
+
+	return result
+}
+
+// Resize a w x h grey plane to dw x dh, one axis at a time.
+func resample(plane []float32, w, h, dw, dh int) []float32 {
+	horizontal := taps(w, dw)
+	vertical := taps(h, dh)
+
+	// Rows first: w x h -> dw x h
+	wide := make([]float32, dw*h)
+	for y := 0; y < h; y++ {
+		src := plane[y*w : (y+1)*w]
+
+		for x, row := range horizontal {
+			var v float32
+			for _, t := range row {
+				v += src[t.index] * t.weight
+			}
+			wide[y*dw+x] = v
+		}
+	}
+
+	// Then columns: dw x h -> dw x dh
+	out := make([]float32, dw*dh)
+	for y, col := range vertical {
+		for x := 0; x < dw; x++ {
+			var v float32
+			for _, t := range col {
+				v += wide[t.index*dw+x] * t.weight
+			}
+
+			// The cubic overshoots a little around hard edges
+			if v < 0 {
+				v = 0
+			} else if v > 1 {
+				v = 1
+			}
+
+			out[y*dw+x] = v
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,81 @@
+package epd7in5v2
+
+import (
+	"image"
+	"image/draw"
+	"testing"
+)
+
+// Bounding box of the black pixels in a panel-sized grey plane.
+func blackBounds(plane []float32) image.Rectangle {
+	var r image.Rectangle
+	for y := 0; y < EPD_HEIGHT; y++ {
+		for x := 0; x < EPD_WIDTH; x++ {
+			if plane[y*EPD_WIDTH+x] < 0.5 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func TestFit(t *testing.T) {
+	// 400x400 solid black square whose bounds don't start at the origin
+	img := image.NewGray(image.Rect(50, 50, 450, 450))
+	draw.Draw(img, img.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	cases := []struct {
+		fit     Fit
+		gravity Gravity
+		want    image.Rectangle
+	}{
+		{FitContain, GravityCenter, image.Rect(160, 0, 640, 480)},
+		{FitContain, GravityLeft, image.Rect(0, 0, 480, 480)},
+		{FitContain, GravityBottomRight, image.Rect(320, 0, 800, 480)},
+		{FitCover, GravityCenter, image.Rect(0, 0, 800, 480)},
+		{FitStretch, GravityCenter, image.Rect(0, 0, 800, 480)},
+		{FitNone, GravityCenter, image.Rect(200, 40, 600, 440)},
+		{FitNone, GravityTopLeft, image.Rect(0, 0, 400, 400)},
+	}
+
+	plane, w, h := greyPlane(img)
+
+	for _, c := range cases {
+		got := blackBounds(fit(plane, w, h, EPD_WIDTH, EPD_HEIGHT, c.fit, c.gravity))
+		if got != c.want {
+			t.Errorf("%s/%s: image covers %v, want %v", c.fit, c.gravity, got, c.want)
+		}
+	}
+}
+
+func TestFitPanelSizedIsUnchanged(t *testing.T) {
+	plane := make([]float32, EPD_WIDTH*EPD_HEIGHT)
+	for i := range plane {
+		plane[i] = float32(i%7) / 6
+	}
+
+	for _, f := range []Fit{FitContain, FitCover, FitStretch, FitNone} {
+		got := fit(plane, EPD_WIDTH, EPD_HEIGHT, EPD_WIDTH, EPD_HEIGHT, f, GravityCenter)
+		for i := range plane {
+			if got[i] != plane[i] {
+				t.Fatalf("%s changed pixel %d from %v to %v", f, i, plane[i], got[i])
+			}
+		}
+	}
+}
+
+func TestResampleUniform(t *testing.T) {
+	plane := make([]float32, 300*200)
+	for i := range plane {
+		plane[i] = 0.25
+	}
+
+	// Flat input stays flat at any scale, including at the edges
+	for _, size := range [][2]int{{800, 480}, {123, 45}, {1, 1}} {
+		for i, v := range resample(plane, 300, 200, size[0], size[1]) {
+			if v < 0.2499 || v > 0.2501 {
+				t.Fatalf("%dx%d: pixel %d is %v, want 0.25", size[0], size[1], i, v)
+			}
+		}
+	}
+}
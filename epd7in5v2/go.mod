@@ -1,3 +1,10 @@
 module tsmith512/epd7in5v2
 
 go 1.19
+
+require (
+	periph.io/x/conn/v3 v3.6.10
+	periph.io/x/host/v3 v3.7.2
+)
+
+require github.com/jonboulle/clockwork v0.2.2 // indirect
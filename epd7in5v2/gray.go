@@ -0,0 +1,244 @@
+package epd7in5v2
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"time"
+)
+
+// In 4-grey mode each pixel takes one bit from the old buffer
+// (DATA_START_TRANSMISSION_1) and one from the new buffer (IMAGE_PROCESS).
+// Instead of the built-in waveforms, the controller drives each pixel with the
+// LUT for its pair of bits, and the LUTs below are tuned so each pair settles
+// on a different tone:
+//
+//	old new  LUT         tone
+//	 1   1   LUT_BLUE    white       (a.k.a. LUTWW)
+//	 1   0   LUT_GRAY_1  light grey  (a.k.a. LUTWK)
+//	 0   1   LUT_WHITE   dark grey   (a.k.a. LUTKW)
+//	 0   0   LUT_GRAY_2  black       (a.k.a. LUTKK)
+//
+// The register names are the ones this package inherited from the HD panel.
+// The waveforms are adapted from Waveshare's 4-grey code for their 4.2" panel,
+// which uses the same LUT layout: groups of six bytes, each a level-select
+// byte, four phase lengths and a repeat count.
+
+const (
+	GRAY_BLACK byte = iota
+	GRAY_DARK
+	GRAY_LIGHT
+	GRAY_WHITE
+)
+
+// Bits in the old and new buffers for each grey tone, per the table above.
+var grayBits = [4][2]Pixel{
+	GRAY_BLACK: {Black, Black},
+	GRAY_DARK:  {Black, White},
+	GRAY_LIGHT: {White, Black},
+	GRAY_WHITE: {White, White},
+}
+
+// Each LUT register takes up to ten 6-byte groups; the unused ones are sent
+// as zeros (no phases) so nothing is left over from a previous upload.
+const lutSize = 60
+
+var LUT_VCOM_4GRAY = []byte{
+	0x00, 0x0A, 0x00, 0x00, 0x00, 0x01,
+	0x60, 0x14, 0x14, 0x00, 0x00, 0x01,
+	0x00, 0x14, 0x00, 0x00, 0x00, 0x01,
+	0x00, 0x13, 0x0A, 0x01, 0x00, 0x01,
+}
+
+var LUT_WW_4GRAY = []byte{
+	0x40, 0x0A, 0x00, 0x00, 0x00, 0x01,
+	0x90, 0x14, 0x14, 0x00, 0x00, 0x01,
+	0x10, 0x14, 0x0A, 0x00, 0x00, 0x01,
+	0xA0, 0x13, 0x01, 0x00, 0x00, 0x01,
+}
+
+var LUT_KW_4GRAY = []byte{
+	0x40, 0x0A, 0x00, 0x00, 0x00, 0x01,
+	0x90, 0x14, 0x14, 0x00, 0x00, 0x01,
+	0x00, 0x14, 0x0A, 0x00, 0x00, 0x01,
+	0x99, 0x0C, 0x01, 0x03, 0x04, 0x01,
+	0x02, 0x04, 0x01, 0x02, 0x01, 0x01,
+}
+
+var LUT_WK_4GRAY = []byte{
+	0x40, 0x0A, 0x00, 0x00, 0x00, 0x01,
+	0x90, 0x14, 0x14, 0x00, 0x00, 0x01,
+	0x00, 0x14, 0x0A, 0x00, 0x00, 0x01,
+	0x99, 0x0B, 0x04, 0x04, 0x01, 0x01,
+}
+
+var LUT_KK_4GRAY = []byte{
+	0x80, 0x0A, 0x00, 0x00, 0x00, 0x01,
+	0x90, 0x14, 0x14, 0x00, 0x00, 0x01,
+	0x20, 0x14, 0x0A, 0x00, 0x00, 0x01,
+	0x50, 0x13, 0x01, 0x00, 0x00, 0x01,
+}
+
+// Init4Gray powers on the display like Init, then switches the controller to
+// the 4-grey waveforms. Use Display4Gray to paint afterwards; Init puts the
+// panel back in black and white mode.
+func (e *Epd) Init4Gray(ctx context.Context) error {
+	if err := e.require(FeatureGray); err != nil {
+		return err
+	}
+	if err := e.Init(ctx); err != nil {
+		return err
+	}
+
+	// log.Println("   - Panel Setting")
+	// 0 0 1 1 1 1 1 1
+	//     * LUT from registers instead of OTP
+	//       * K/W Mode
+	//         * * * * Default values
+	if err := e.commandAndWait(ctx, PANEL_SETTING, 0x3F); err != nil {
+		return err
+	}
+
+	luts := []struct {
+		cmd byte
+		lut []byte
+	}{
+		{LUT_FOR_VCOM, LUT_VCOM_4GRAY},
+		{LUT_BLUE, LUT_WW_4GRAY},
+		{LUT_WHITE, LUT_KW_4GRAY},
+		{LUT_GRAY_1, LUT_WK_4GRAY},
+		{LUT_GRAY_2, LUT_KK_4GRAY},
+	}
+
+	for _, l := range luts {
+		if err := e.sendLUT(l.cmd, l.lut); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Upload a waveform table, padded with empty groups to the register's size.
+func (e *Epd) sendLUT(cmd byte, lut []byte) error {
+	padded := make([]byte, lutSize)
+	copy(padded, lut)
+
+	return e.command(cmd, padded...)
+}
+
+// Paint a pair of buffers from Convert4Gray. Requires Init4Gray.
+func (e *Epd) Display4Gray(ctx context.Context, oldData, newData []byte) error {
+	if err := e.sendFrame(DATA_START_TRANSMISSION_1, oldData); err != nil {
+		return err
+	}
+	if err := e.sendFrame(IMAGE_PROCESS, newData); err != nil {
+		return err
+	}
+	if err := e.sendCommand(DISPLAY_REFRESH); err != nil {
+		return err
+	}
+	sleep(5 * time.Second)
+
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	// Neither buffer is a black and white frame, so the next Display can't use
+	// them as its old data.
+	e.previous = nil
+	return nil
+}
+
+// Show4Gray converts an image to four tones and paints it. Requires Init4Gray.
+func (e *Epd) Show4Gray(ctx context.Context, img image.Image) error {
+	oldData, newData := e.Convert4Gray(img)
+	return e.Display4Gray(ctx, oldData, newData)
+}
+
+// Convert4Gray prepares an image for Display4Gray using the Epd's Options.
+func (e *Epd) Convert4Gray(img image.Image) (oldData, newData []byte) {
+	return e.panel.Convert4Gray(img, e.Options)
+}
+
+// Convert4Gray prepares an image for Display4Gray on the 7.5" V2. See
+// Panel.Convert4Gray.
+func Convert4Gray(img image.Image, opts Options) (oldData, newData []byte) {
+	return panel7in5v2.Convert4Gray(img, opts)
+}
+
+// Convert4Gray reduces the input image to four tones and packs it into the old
+// and new buffers for Display4Gray. Like Convert, it needs no hardware.
+func (p *Panel) Convert4Gray(img image.Image, opts Options) (oldData, newData []byte) {
+	widthByte, heightByte := p.bufferSize()
+	oldData = make([]byte, widthByte*heightByte)
+	newData = make([]byte, widthByte*heightByte)
+
+	tones := p.prepare(img, opts, 4)
+
+	for j := 0; j < p.Height; j++ {
+		for i := 0; i < p.Width; i++ {
+			tone := tones[j*p.Width+i]
+			if opts.Invert {
+				tone = GRAY_WHITE - tone
+			}
+
+			bits := grayBits[tone]
+			mask := byte(0x80) >> (uint32(i) % 8)
+			offset := (i / 8) + (j * widthByte)
+
+			if bits[0] == White {
+				oldData[offset] |= mask
+			}
+			if bits[1] == White {
+				newData[offset] |= mask
+			}
+		}
+	}
+
+	return oldData, newData
+}
+
+// The tones the 4-grey LUTs aim for, darkest first.
+var grayPalette = color.Palette{
+	color.Gray{Y: 0x00},
+	color.Gray{Y: 0x55},
+	color.Gray{Y: 0xAA},
+	color.Gray{Y: 0xFF},
+}
+
+// Unpack4Gray turns buffers for the 7.5" V2 back into an image. See
+// Panel.Unpack4Gray.
+func Unpack4Gray(oldData, newData []byte) *image.Paletted {
+	return panel7in5v2.Unpack4Gray(oldData, newData)
+}
+
+// Unpack4Gray turns buffers from Convert4Gray back into an image of how they
+// should look on the panel. Anything past the end of the buffers is white.
+func (p *Panel) Unpack4Gray(oldData, newData []byte) *image.Paletted {
+	img := image.NewPaletted(p.Bounds(), grayPalette)
+	widthByte, _ := p.bufferSize()
+
+	bit := func(buffer []byte, offset int, mask byte) Pixel {
+		if offset >= len(buffer) || buffer[offset]&mask != 0 {
+			return White
+		}
+		return Black
+	}
+
+	for j := 0; j < p.Height; j++ {
+		for i := 0; i < p.Width; i++ {
+			mask := byte(0x80) >> (uint32(i) % 8)
+			offset := (i / 8) + (j * widthByte)
+			pair := [2]Pixel{bit(oldData, offset, mask), bit(newData, offset, mask)}
+
+			for tone, bits := range grayBits {
+				if bits == pair {
+					img.SetColorIndex(i, j, uint8(tone))
+				}
+			}
+		}
+	}
+
+	return img
+}
@@ -0,0 +1,45 @@
+package epd7in5v2
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestInit4Gray(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	if err := e.Init4Gray(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "init_4gray", dump(r.transfers))
+}
+
+func TestConvert4GrayRoundTrip(t *testing.T) {
+	// Four vertical bands, black to white
+	img := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	for x := 0; x < EPD_WIDTH; x++ {
+		for y := 0; y < EPD_HEIGHT; y++ {
+			img.SetGray(x, y, grayPalette[x*4/EPD_WIDTH].(color.Gray))
+		}
+	}
+
+	oldData, newData := Convert4Gray(img, Options{})
+	frame := Unpack4Gray(oldData, newData)
+
+	for x := 0; x < EPD_WIDTH; x++ {
+		for y := 0; y < EPD_HEIGHT; y++ {
+			if got, want := frame.ColorIndexAt(x, y), uint8(x*4/EPD_WIDTH); got != want {
+				t.Fatalf("pixel (%d, %d) is tone %d, want %d", x, y, got, want)
+			}
+		}
+	}
+
+	// Spot-check the bit pairs against the table in gray.go: a dark grey pixel
+	// is 0 in the old buffer and 1 in the new.
+	if oldData[30] != 0x00 || newData[30] != 0xFF {
+		t.Errorf("dark grey packed as old %02X, new %02X; want 00, FF", oldData[30], newData[30])
+	}
+}
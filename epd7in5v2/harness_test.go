@@ -0,0 +1,232 @@
+package epd7in5v2
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// transfer is one command byte plus the data that followed it, as the
+// controller sees it.
+type transfer struct {
+	cmd  byte
+	data []byte
+}
+
+// recorder stands in for the SPI connection. It splits the byte stream into
+// commands and data by watching the DC pin, the same way the controller does:
+// DC low is a command byte, DC high is data for the last command.
+type recorder struct {
+	dc        *gpiotest.Pin
+	cs        *gpiotest.Pin
+	transfers []transfer
+
+	// Fail the Nth call to Tx (counting from 1) to simulate a bad connection.
+	failAt int
+	calls  int
+
+	// What the controller answers when read after each command.
+	replies map[byte][]byte
+}
+
+var errLoose = errors.New("recorder: ribbon cable came loose")
+
+func (r *recorder) String() string {
+	return "recorder"
+}
+
+func (r *recorder) Duplex() conn.Duplex {
+	return conn.Half
+}
+
+func (r *recorder) Tx(w, read []byte) error {
+	r.calls++
+	if r.calls == r.failAt {
+		return errLoose
+	}
+
+	if r.cs.Read() != gpio.Low {
+		return errors.New("recorder: transfer while CS is not selected")
+	}
+
+	if r.dc.Read() == gpio.Low {
+		for _, b := range w {
+			r.transfers = append(r.transfers, transfer{cmd: b})
+		}
+		return nil
+	}
+
+	if len(r.transfers) == 0 {
+		return errors.New("recorder: data sent before any command")
+	}
+
+	last := &r.transfers[len(r.transfers)-1]
+	last.data = append(last.data, w...)
+	copy(read, r.replies[last.cmd])
+	return nil
+}
+
+// Data sent with the most recent instance of a command, or nil.
+func (r *recorder) last(cmd byte) []byte {
+	for i := len(r.transfers) - 1; i >= 0; i-- {
+		if r.transfers[i].cmd == cmd {
+			return r.transfers[i].data
+		}
+	}
+	return nil
+}
+
+// Names for the golden files, so they can be read against the spec.
+var commandNames = map[byte]string{
+	PANEL_SETTING:                  "PANEL_SETTING",
+	POWER_SETTING:                  "POWER_SETTING",
+	POWER_OFF:                      "POWER_OFF",
+	POWER_ON:                       "POWER_ON",
+	BOOSTER_SOFT_START:             "BOOSTER_SOFT_START",
+	DEEP_SLEEP:                     "DEEP_SLEEP",
+	DATA_START_TRANSMISSION_1:      "DATA_START_TRANSMISSION_1",
+	DATA_STOP:                      "DATA_STOP",
+	DISPLAY_REFRESH:                "DISPLAY_REFRESH",
+	IMAGE_PROCESS:                  "IMAGE_PROCESS",
+	DUAL_SPI_MODE:                  "DUAL_SPI_MODE",
+	PLL_CONTROL:                    "PLL_CONTROL",
+	VCOM_AND_DATA_INTERVAL_SETTING: "VCOM_AND_DATA_INTERVAL_SETTING",
+	TCON_SETTING:                   "TCON_SETTING",
+	TCON_RESOLUTION:                "TCON_RESOLUTION",
+	SPI_FLASH_CONTROL:              "SPI_FLASH_CONTROL",
+	VCM_DC_SETTING:                 "VCM_DC_SETTING",
+	LUT_FOR_VCOM:                   "LUT_FOR_VCOM",
+	LUT_BLUE:                       "LUT_BLUE",
+	LUT_WHITE:                      "LUT_WHITE",
+	LUT_GRAY_1:                     "LUT_GRAY_1",
+	LUT_GRAY_2:                     "LUT_GRAY_2",
+	PARTIAL_WINDOW:                 "PARTIAL_WINDOW",
+	PARTIAL_IN:                     "PARTIAL_IN",
+	PARTIAL_OUT:                    "PARTIAL_OUT",
+	CASCADE_SETTING:                "CASCADE_SETTING",
+	FORCE_TEMPERATURE:              "FORCE_TEMPERATURE",
+	TEMPERATURE_SENSOR_COMMAND:     "TEMPERATURE_SENSOR_COMMAND",
+	TEMPERATURE_CALIBRATION:        "TEMPERATURE_CALIBRATION",
+	REVISION:                       "REVISION",
+	GET_STATUS:                     "GET_STATUS",
+}
+
+// The same for the SSD1677 on the 7.5" HD.
+var ssdNames = map[byte]string{
+	SSD_DRIVER_OUTPUT_CONTROL:  "DRIVER_OUTPUT_CONTROL",
+	SSD_BOOSTER_SOFT_START:     "BOOSTER_SOFT_START",
+	SSD_DEEP_SLEEP:             "DEEP_SLEEP",
+	SSD_DATA_ENTRY_MODE:        "DATA_ENTRY_MODE",
+	SSD_SW_RESET:               "SW_RESET",
+	SSD_TEMPERATURE_SENSOR:     "TEMPERATURE_SENSOR",
+	SSD_MASTER_ACTIVATION:      "MASTER_ACTIVATION",
+	SSD_DISPLAY_UPDATE_CONTROL: "DISPLAY_UPDATE_CONTROL",
+	SSD_WRITE_RAM_BW:           "WRITE_RAM_BW",
+	SSD_BORDER_WAVEFORM:        "BORDER_WAVEFORM",
+	SSD_RAM_X_RANGE:            "RAM_X_RANGE",
+	SSD_RAM_Y_RANGE:            "RAM_Y_RANGE",
+	SSD_AUTO_WRITE_RED_RAM:     "AUTO_WRITE_RED_RAM",
+	SSD_AUTO_WRITE_BW_RAM:      "AUTO_WRITE_BW_RAM",
+	SSD_RAM_X_ADDRESS_COUNTER:  "RAM_X_ADDRESS_COUNTER",
+	SSD_RAM_Y_ADDRESS_COUNTER:  "RAM_Y_ADDRESS_COUNTER",
+}
+
+// Render transfers one command per line. Short payloads are written out in
+// full; framebuffers are summarized so the golden files stay readable.
+func dump(transfers []transfer) string {
+	return dumpWith(commandNames, transfers)
+}
+
+func dumpWith(names map[byte]string, transfers []transfer) string {
+	var b strings.Builder
+
+	for _, t := range transfers {
+		fmt.Fprintf(&b, "%02X %s", t.cmd, names[t.cmd])
+
+		switch {
+		case len(t.data) == 0:
+		case len(t.data) <= 16 || len(t.data) == lutSize:
+			fmt.Fprintf(&b, ": % X", t.data)
+		case bytes.Count(t.data, t.data[:1]) == len(t.data):
+			fmt.Fprintf(&b, ": %d x %02X", len(t.data), t.data[0])
+		default:
+			fmt.Fprintf(&b, ": %d bytes, sha256 %x", len(t.data), sha256.Sum256(t.data))
+		}
+
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// Compare against testdata/<name>.golden, or rewrite it with -update.
+func assertGolden(t *testing.T, name string, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != string(want) {
+		t.Errorf("%s does not match:\n--- got ---\n%s--- want ---\n%s", path, got, want)
+	}
+}
+
+// Build an Epd wired to fake pins and a recording connection. The busy pin
+// reads as idle, replies can be read, and the driver's delays are skipped.
+func newTestEpd(t *testing.T) (*Epd, *recorder) {
+	t.Helper()
+	return newTestPanel(t, panel7in5v2)
+}
+
+// As newTestEpd, for another panel.
+func newTestPanel(t *testing.T, panel *Panel) (*Epd, *recorder) {
+	t.Helper()
+
+	sleep = func(time.Duration) {}
+	t.Cleanup(func() { sleep = time.Sleep })
+
+	dc := &gpiotest.Pin{N: "DC"}
+	cs := &gpiotest.Pin{N: "CS"}
+	rst := &gpiotest.Pin{N: "RST"}
+	busy := &gpiotest.Pin{N: "BUSY", L: panel.idle, EdgesChan: make(chan gpio.Level, 1)}
+
+	r := &recorder{dc: dc, cs: cs}
+	widthByte, heightByte := panel.bufferSize()
+
+	e := &Epd{
+		panel:      panel,
+		c:          r,
+		dc:         dc,
+		cs:         cs,
+		rst:        rst,
+		busy:       busy,
+		widthByte:  widthByte,
+		heightByte: heightByte,
+		readable:   true,
+		asleep:     true,
+	}
+
+	return e, r
+}
@@ -0,0 +1,197 @@
+package epd7in5v2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// Panel describes one model of e-paper panel: its size, how to set up and
+// paint with its controller, and which of the optional features it has. The
+// SPI and GPIO handling in Epd is the same for all of them.
+type Panel struct {
+	Model         string // Name in the registry and the config file
+	Name          string // What it's sold as
+	Width, Height int
+	Features      Feature
+
+	// BUSY level when the controller is ready for more
+	idle gpio.Level
+
+	// Power on and configure the controller, after which display paints a
+	// packed frame (see Convert), given the one already on screen. powerDown
+	// puts the controller in its lowest power state.
+	initialize func(e *Epd, ctx context.Context) error
+	display    func(e *Epd, ctx context.Context, old, frame []byte) error
+	powerDown  func(e *Epd, ctx context.Context) error
+}
+
+// Feature is a set of optional driver features a panel supports.
+type Feature uint
+
+const (
+	FeatureGray    Feature = 1 << iota // Init4Gray, Display4Gray, Show4Gray
+	FeatureFast                        // InitFast
+	FeaturePartial                     // InitPartial, DisplayPartial
+	FeatureSensor                      // Temperature, ForceTemperature, Status, Revision
+	FeatureRed                         // Display3Color, Show3Color
+)
+
+var featureNames = []struct {
+	feature Feature
+	name    string
+}{
+	{FeatureGray, "4-grey mode"},
+	{FeatureFast, "fast refresh"},
+	{FeaturePartial, "partial refresh"},
+	{FeatureSensor, "sensor readback"},
+	{FeatureRed, "red ink"},
+}
+
+// Lists the features in the set, e.g. "fast refresh, partial refresh".
+func (f Feature) String() string {
+	var names []string
+	for _, n := range featureNames {
+		if f&n.feature != 0 {
+			names = append(names, n.name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Supports reports whether the panel has all of the features in f.
+func (p *Panel) Supports(f Feature) bool {
+	return p.Features&f == f
+}
+
+// Registered panels by model name. Each panel's file adds itself in init().
+var panels = map[string]*Panel{}
+
+func register(p *Panel) {
+	panels[p.Model] = p
+}
+
+// LookupPanel finds a panel by model name.
+func LookupPanel(model string) (*Panel, error) {
+	if p, ok := panels[model]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("epd: unknown panel model '%s' (known: %s)", model, strings.Join(Models(), ", "))
+}
+
+// Models lists the model names of every registered panel.
+func Models() []string {
+	models := make([]string, 0, len(panels))
+	for model := range panels {
+		models = append(models, model)
+	}
+
+	sort.Strings(models)
+	return models
+}
+
+// Bounds of the drawable area in device pixels.
+func (p *Panel) Bounds() image.Rectangle {
+	return image.Rect(0, 0, p.Width, p.Height)
+}
+
+// Dimensions of a packed frame: bytes per row, and rows.
+func (p *Panel) bufferSize() (widthByte, heightByte int) {
+	return (p.Width + 7) / 8, p.Height
+}
+
+// Convert the input image into bitmap as a ready-to-display B&W bytearray,
+// with bits as described by Pixel. This needs no hardware, so it can be used
+// to preview what the panel will get.
+func (p *Panel) Convert(img image.Image, opts Options) []byte {
+	return p.ConvertInto(nil, img, opts)
+}
+
+// ConvertInto is Convert, reusing dst for the frame if it's big enough.
+// Returns the frame, which shares dst's storage in that case.
+func (p *Panel) ConvertInto(dst []byte, img image.Image, opts Options) []byte {
+	widthByte, heightByte := p.bufferSize()
+
+	buffer := dst[:0]
+	if cap(buffer) < widthByte*heightByte {
+		buffer = make([]byte, widthByte*heightByte)
+	} else {
+		buffer = buffer[:widthByte*heightByte]
+		for i := range buffer {
+			buffer[i] = 0
+		}
+	}
+
+	// Reduce the image to black (0) and white (1) for each device pixel
+	tones := p.prepare(img, opts, 2)
+
+	// Iterate through individual device pixel coords by col within row:
+	for j := 0; j < p.Height; j++ {
+		for i := 0; i < p.Width; i++ {
+			pixel := Pixel(tones[j*p.Width+i])
+			if opts.Invert {
+				pixel ^= 1
+			}
+
+			// Pack 8 pixels (as individual bits) into each byte, leftmost pixel
+			// in the highest bit.
+			if pixel == White {
+				buffer[(i/8)+(j*widthByte)] |= 0x80 >> (uint32(i) % 8)
+			}
+		}
+	}
+
+	return buffer
+}
+
+// Turn the image to match how the panel is mounted, size it to the panel,
+// then reduce it to `levels` tones. Returns a tone per device pixel, row-major,
+// from 0 (black) to levels-1 (white).
+func (p *Panel) prepare(img image.Image, opts Options, levels int) []uint8 {
+	plane, w, h := greyPlane(img)
+	plane, w, h = orient(plane, w, h, opts.Rotation, opts.MirrorHorizontal, opts.MirrorVertical)
+	plane = fit(plane, w, h, p.Width, p.Height, opts.Fit, opts.Gravity)
+
+	return quantize(plane, p.Width, p.Height, levels, opts.Dither)
+}
+
+// Blank returns a packed frame that is entirely white.
+func (p *Panel) Blank() []byte {
+	widthByte, heightByte := p.bufferSize()
+	return bytes.Repeat([]byte{White.fill()}, widthByte*heightByte)
+}
+
+// Unpack a bitmap made by Convert back into a 1-bit image, exactly as the
+// panel would show it. Useful for previewing frames without the hardware.
+// Anything past the end of the buffer is white.
+func (p *Panel) Unpack(buffer []byte) *image.Paletted {
+	// Palette index is the Pixel value: 0 is black, 1 is white.
+	img := image.NewPaletted(
+		p.Bounds(),
+		color.Palette([]color.Color{color.Black, color.White}),
+	)
+
+	widthByte, _ := p.bufferSize()
+
+	for j := 0; j < p.Height; j++ {
+		for i := 0; i < p.Width; i++ {
+			offset := (i / 8) + (j * widthByte)
+
+			if offset >= len(buffer) || buffer[offset]&(0x80>>(uint32(i)%8)) != 0 {
+				img.SetColorIndex(i, j, uint8(White))
+			}
+		}
+	}
+
+	return img
+}
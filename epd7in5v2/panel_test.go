@@ -0,0 +1,129 @@
+package epd7in5v2
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestModels(t *testing.T) {
+	want := []string{"epd4in2", "epd5in83v2", "epd7in5", "epd7in5bv2", "epd7in5hd", "epd7in5v2"}
+	if got := Models(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Models() = %v, want %v", got, want)
+	}
+}
+
+func TestLookupPanel(t *testing.T) {
+	p, err := LookupPanel("epd7in5hd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Width != 880 || p.Height != 528 {
+		t.Errorf("epd7in5hd is %dx%d, want 880x528", p.Width, p.Height)
+	}
+
+	_, err = LookupPanel("epd2in13")
+	if err == nil || !strings.Contains(err.Error(), "epd7in5v2") {
+		t.Errorf("unknown model gave %v, want an error listing the known ones", err)
+	}
+}
+
+// Init and Clear for each of the other panels, recorded against the Python
+// examples.
+func TestPanelInitAndClear(t *testing.T) {
+	for _, p := range []*Panel{panel7in5, panel7in5hd, panel7in5bv2, panel5in83v2, panel4in2} {
+		t.Run(p.Model, func(t *testing.T) {
+			e, r := newTestPanel(t, p)
+
+			names := commandNames
+			if p == panel7in5hd {
+				names = ssdNames
+			}
+
+			if err := e.Init(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, "init_"+p.Model, dumpWith(names, r.transfers))
+
+			r.transfers = nil
+			if err := e.Clear(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Sleep(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, "clear_"+p.Model, dumpWith(names, r.transfers))
+
+			if got := e.Bounds(); got != p.Bounds() {
+				t.Errorf("Bounds() = %v, want %v", got, p.Bounds())
+			}
+		})
+	}
+}
+
+func TestPanelConvertSize(t *testing.T) {
+	// 648 isn't a multiple of 8, so rows are padded to 81 bytes
+	img := image.NewGray(panel5in83v2.Bounds())
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	frame := panel5in83v2.Convert(img, Options{})
+	if len(frame) != 81*480 {
+		t.Errorf("frame is %d bytes, want %d", len(frame), 81*480)
+	}
+	if got := panel5in83v2.Unpack(frame).Bounds(); got != panel5in83v2.Bounds() {
+		t.Errorf("Unpack gave %v, want %v", got, panel5in83v2.Bounds())
+	}
+}
+
+// The V1 controller takes four bits per pixel: 0x0 black, 0x3 white.
+func TestDisplay7in5Widens(t *testing.T) {
+	e, r := newTestPanel(t, panel7in5)
+
+	frame := panel7in5.Blank()
+	frame[0] = 0x5A // 0101 1010
+
+	if err := e.Display(context.Background(), frame); err != nil {
+		t.Fatal(err)
+	}
+
+	data := r.last(DATA_START_TRANSMISSION_1)
+	if len(data) != len(frame)*4 {
+		t.Fatalf("sent %d bytes, want %d", len(data), len(frame)*4)
+	}
+	if want := []byte{0x03, 0x03, 0x30, 0x30}; !reflect.DeepEqual(data[:4], want) {
+		t.Errorf("first byte widened to % X, want % X", data[:4], want)
+	}
+	if data[4] != 0x33 {
+		t.Errorf("white widened to %02X, want 33", data[4])
+	}
+}
+
+func TestUnsupportedFeatures(t *testing.T) {
+	e, r := newTestPanel(t, panel4in2)
+	ctx := context.Background()
+
+	if e.Supports(FeatureFast) {
+		t.Error("epd4in2 should not support fast refresh")
+	}
+
+	err := e.InitFast(ctx)
+	if err == nil || !strings.Contains(err.Error(), "fast refresh") {
+		t.Errorf("InitFast gave %v, want an unsupported feature error", err)
+	}
+	if _, err := e.Temperature(ctx); err == nil {
+		t.Error("Temperature should fail without sensor readback")
+	}
+	if err := e.InitPartial(ctx); err == nil {
+		t.Error("InitPartial should fail without partial refresh")
+	}
+	if err := e.Init4Gray(ctx); err == nil {
+		t.Error("Init4Gray should fail without 4-grey mode")
+	}
+
+	if len(r.transfers) != 0 {
+		t.Errorf("unsupported calls sent %d commands", len(r.transfers))
+	}
+}
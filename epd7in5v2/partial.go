@@ -0,0 +1,183 @@
+package epd7in5v2
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"time"
+)
+
+// InitPartial powers on the display for partial updates with DisplayPartial.
+// This follows Waveshare's init_part(): the controller is told the panel is
+// at a high temperature (FORCE_TEMPERATURE), which selects the short OTP
+// waveform. It's quick and doesn't flash, but ghosts, so follow a few
+// partial updates with a full refresh from Init and Display.
+func (e *Epd) InitPartial(ctx context.Context) error {
+	if err := e.require(FeaturePartial); err != nil {
+		return err
+	}
+	e.fast = false
+
+	// log.Println("   - Reset")
+	if err := e.Reset(); err != nil {
+		return err
+	}
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	// log.Println("   - Panel Setting")
+	// K/W mode, LUT from OTP, as in Init
+	if err := e.command(PANEL_SETTING, 0x1F); err != nil {
+		return err
+	}
+
+	// log.Println("   - Force Temperature")
+	// Cascade setting bit 1 (TSFIX) takes the temperature from FORCE_TEMPERATURE
+	// instead of the sensor.
+	if err := e.command(CASCADE_SETTING, 0x02); err != nil {
+		return err
+	}
+	if err := e.command(FORCE_TEMPERATURE, 0x6E); err != nil {
+		return err
+	}
+
+	// log.Println("   - VCOM and DATA")
+	// 1 0 1 0 1 0 0 1
+	// *               Border floating, so the edge doesn't flash either
+	//     * *         Border output: LUTW
+	//               * Data polarity (DDX) = 01, same as Init: see Pixel
+	if err := e.command(VCOM_AND_DATA_INTERVAL_SETTING, 0xA9, 0x07); err != nil {
+		return err
+	}
+
+	// log.Println("   - Display Power On")
+	if err := e.sendCommand(POWER_ON); err != nil {
+		return err
+	}
+	sleep(100 * time.Millisecond)
+
+	return e.waitUntilIdle(ctx)
+}
+
+// DisplayPartial redraws only the area of the screen inside rect, taking the
+// pixels from img at the same panel coordinates (anything img doesn't cover is
+// white). The controller addresses whole bytes, so rect is widened to multiples
+// of 8 pixels horizontally; it is also clipped to the panel. Images are not
+// rotated or fitted: the caller works in panel coordinates. Requires
+// InitPartial.
+func (e *Epd) DisplayPartial(ctx context.Context, rect image.Rectangle, img image.Image) error {
+	if err := e.require(FeaturePartial); err != nil {
+		return err
+	}
+
+	rect = partialWindow(rect, e.panel.Bounds())
+	if rect.Empty() {
+		return errors.New("epd: partial update is outside the panel")
+	}
+
+	window := convertWindow(rect, img, e.Options)
+
+	if err := e.sendCommand(PARTIAL_IN); err != nil {
+		return err
+	}
+
+	// Start and end (inclusive) of the window, as 16-bit big-endian values
+	x0, x1 := rect.Min.X, rect.Max.X-1
+	y0, y1 := rect.Min.Y, rect.Max.Y-1
+	err := e.command(PARTIAL_WINDOW,
+		byte(x0>>8), byte(x0), byte(x1>>8), byte(x1),
+		byte(y0>>8), byte(y0), byte(y1>>8), byte(y1),
+		0x01, // Scan inside the window only
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := e.sendFrame(IMAGE_PROCESS, window); err != nil {
+		return err
+	}
+	if err := e.sendCommand(DISPLAY_REFRESH); err != nil {
+		return err
+	}
+	sleep(100 * time.Millisecond)
+
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	if err := e.sendCommand(PARTIAL_OUT); err != nil {
+		return err
+	}
+
+	e.updatePrevious(rect, window)
+	return nil
+}
+
+// Align a partial update area to whole bytes and clip it to the panel.
+func partialWindow(rect, bounds image.Rectangle) image.Rectangle {
+	rect = rect.Canon().Intersect(bounds)
+	if rect.Empty() {
+		return image.Rectangle{}
+	}
+
+	rect.Min.X = rect.Min.X / 8 * 8
+	rect.Max.X = (rect.Max.X + 7) / 8 * 8
+
+	return rect
+}
+
+// Pack the pixels of img inside rect (already byte-aligned) as a small frame,
+// one row of rect.Dx()/8 bytes per line, with the same bits as Convert.
+func convertWindow(rect image.Rectangle, img image.Image, opts Options) []byte {
+	w, h := rect.Dx(), rect.Dy()
+	bounds := img.Bounds()
+
+	plane := make([]float32, w*h)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			p := rect.Min.Add(image.Pt(i, j))
+			v := float32(1)
+
+			if p.In(bounds) {
+				v = float32(color.Gray16Model.Convert(img.At(p.X, p.Y)).(color.Gray16).Y) / 0xffff
+			}
+
+			plane[j*w+i] = v
+		}
+	}
+
+	tones := quantize(plane, w, h, 2, opts.Dither)
+	window := make([]byte, w/8*h)
+
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			pixel := Pixel(tones[j*w+i])
+			if opts.Invert {
+				pixel ^= 1
+			}
+
+			if pixel == White {
+				window[j*(w/8)+i/8] |= 0x80 >> (uint32(i) % 8)
+			}
+		}
+	}
+
+	return window
+}
+
+// Copy a window that was just drawn into the record of what's on screen, so
+// the next full Display sends the right old data.
+func (e *Epd) updatePrevious(rect image.Rectangle, window []byte) {
+	if e.previous == nil {
+		// Don't know what was around the window
+		return
+	}
+
+	rowBytes := rect.Dx() / 8
+	for j := 0; j < rect.Dy(); j++ {
+		start := (rect.Min.Y+j)*e.widthByte + rect.Min.X/8
+		copy(e.previous[start:start+rowBytes], window[j*rowBytes:(j+1)*rowBytes])
+	}
+}
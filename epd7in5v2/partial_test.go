@@ -0,0 +1,156 @@
+package epd7in5v2
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestInitPartial(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	if err := e.InitPartial(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "init_partial", dump(r.transfers))
+}
+
+func TestDisplayPartial(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	// A black badge in the top right corner, not aligned to whole bytes
+	img := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	badge := image.Rect(EPD_WIDTH-45, 3, EPD_WIDTH-5, 19)
+	for y := badge.Min.Y; y < badge.Max.Y; y++ {
+		for x := badge.Min.X; x < badge.Max.X; x++ {
+			img.SetGray(x, y, color.Gray{})
+		}
+	}
+
+	if err := e.DisplayPartial(context.Background(), badge, img); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "display_partial", dump(r.transfers))
+
+	// Widened from 755..795 to 752..800, with white either side of the badge
+	window := r.last(IMAGE_PROCESS)
+	if want := 6 * 16; len(window) != want {
+		t.Fatalf("window is %d bytes, want %d", len(window), want)
+	}
+	row := window[:6]
+	if want := []byte{0xE0, 0x00, 0x00, 0x00, 0x00, 0x1F}; !bytes.Equal(row, want) {
+		t.Errorf("first row is % X, want % X", row, want)
+	}
+}
+
+func TestDisplayPartialUpdatesPrevious(t *testing.T) {
+	e, r := newTestEpd(t)
+	ctx := context.Background()
+
+	if err := e.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	black := image.NewUniform(color.Black)
+	if err := e.DisplayPartial(ctx, image.Rect(0, 0, 8, 2), black); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next full update should know those two bytes are black now
+	if err := e.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	old := r.last(DATA_START_TRANSMISSION_1)
+	if old[0] != 0x00 || old[e.widthByte] != 0x00 || old[1] != 0xFF {
+		t.Errorf("old data starts % X ... % X, want the window black", old[:2], old[e.widthByte:e.widthByte+2])
+	}
+}
+
+func TestDisplayPartialOutsidePanel(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	rect := image.Rect(EPD_WIDTH, 0, EPD_WIDTH+10, 10)
+	if err := e.DisplayPartial(context.Background(), rect, image.White); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if len(r.transfers) != 0 {
+		t.Errorf("sent %d commands, want none", len(r.transfers))
+	}
+}
+
+func TestDisplayPartialLeavesCallerFrame(t *testing.T) {
+	e, _ := newTestEpd(t)
+	ctx := context.Background()
+
+	frame := e.panel.Blank()
+	if err := e.Display(ctx, frame); err != nil {
+		t.Fatal(err)
+	}
+
+	black := image.NewUniform(color.Black)
+	if err := e.DisplayPartial(ctx, image.Rect(0, 0, 8, 2), black); err != nil {
+		t.Fatal(err)
+	}
+
+	// The driver's record of the screen changed, not the caller's buffer
+	if !bytes.Equal(frame, e.panel.Blank()) {
+		t.Error("DisplayPartial wrote into the frame passed to Display")
+	}
+	if e.previous[0] != 0x00 {
+		t.Errorf("previous frame starts %02X, want the window black", e.previous[0])
+	}
+}
+
+// Partial mode doesn't carry over InitFast's waveform, so a full refresh after
+// it waits as long as a normal one.
+func TestFastThenPartialThenFull(t *testing.T) {
+	e, r := newTestEpd(t)
+	ctx := context.Background()
+
+	var longest time.Duration
+	sleep = func(d time.Duration) {
+		if d > longest {
+			longest = d
+		}
+	}
+
+	if err := e.InitFast(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.InitPartial(ctx); err != nil {
+		t.Fatal(err)
+	}
+	black := image.NewUniform(color.Black)
+	if err := e.DisplayPartial(ctx, image.Rect(0, 0, 8, 2), black); err != nil {
+		t.Fatal(err)
+	}
+
+	r.transfers = nil
+	longest = 0
+	if err := e.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if longest < time.Second {
+		t.Errorf("full refresh after partial mode only slept %s", longest)
+	}
+
+	// Old data is the cleared frame with the partial window drawn in
+	old := r.last(DATA_START_TRANSMISSION_1)
+	if old[0] != 0x00 || old[1] != 0xFF {
+		t.Errorf("old data starts % X, want the window black", old[:2])
+	}
+}
@@ -0,0 +1,222 @@
+package epd7in5v2
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"time"
+)
+
+// Three-colour panels run the controller in K/W/R mode, which takes two
+// planes with one bit per pixel each, instead of old and new frames:
+//
+//	black plane (DATA_START_TRANSMISSION_1): 0 black, 1 white, as Pixel
+//	red plane (IMAGE_PROCESS):               1 red, 0 as the black plane
+//
+// Red wins where both are set. The red waveform is much longer than the K/W
+// one, around 20 seconds, and flashes the panel several times.
+
+const (
+	RED_BLACK byte = iota
+	RED_WHITE
+	RED_RED
+)
+
+// The inks, in the order of the tones above.
+var redPalette = color.Palette{
+	color.RGBA{0x00, 0x00, 0x00, 0xFF},
+	color.RGBA{0xFF, 0xFF, 0xFF, 0xFF},
+	color.RGBA{0xFF, 0x00, 0x00, 0xFF},
+}
+
+// Display3Color paints a pair of planes from Convert3Color. Requires Init on
+// a panel with FeatureRed.
+func (e *Epd) Display3Color(ctx context.Context, black, red []byte) error {
+	if err := e.require(FeatureRed); err != nil {
+		return err
+	}
+
+	return e.paint3Color(ctx, black, red)
+}
+
+func (e *Epd) paint3Color(ctx context.Context, black, red []byte) error {
+	if err := e.sendFrame(DATA_START_TRANSMISSION_1, black); err != nil {
+		return err
+	}
+	if err := e.sendFrame(IMAGE_PROCESS, red); err != nil {
+		return err
+	}
+	if err := e.sendCommand(DISPLAY_REFRESH); err != nil {
+		return err
+	}
+	sleep(5 * time.Second)
+
+	if err := e.waitUntilIdle(ctx); err != nil {
+		return err
+	}
+
+	// K/W/R mode has no old data, so there's nothing to keep for Display
+	e.previous = nil
+	return nil
+}
+
+// Show3Color converts an image to black, white and red and paints it.
+func (e *Epd) Show3Color(ctx context.Context, img image.Image) error {
+	black, red := e.Convert3Color(img)
+	return e.Display3Color(ctx, black, red)
+}
+
+// Convert3Color prepares an image for Display3Color using the Epd's Options.
+func (e *Epd) Convert3Color(img image.Image) (black, red []byte) {
+	return e.panel.Convert3Color(img, e.Options)
+}
+
+// Convert3Color reduces the input image to black, white and red, and packs it
+// into the two planes for Display3Color. Like Convert, it needs no hardware.
+// Invert swaps black and white, and leaves red alone.
+func (p *Panel) Convert3Color(img image.Image, opts Options) (black, red []byte) {
+	widthByte, heightByte := p.bufferSize()
+	black = make([]byte, widthByte*heightByte)
+	red = make([]byte, widthByte*heightByte)
+
+	tones := p.prepare3Color(img, opts)
+
+	for j := 0; j < p.Height; j++ {
+		for i := 0; i < p.Width; i++ {
+			tone := tones[j*p.Width+i]
+			if opts.Invert && tone != RED_RED {
+				tone ^= 1
+			}
+
+			mask := byte(0x80) >> (uint32(i) % 8)
+			offset := (i / 8) + (j * widthByte)
+
+			switch tone {
+			case RED_WHITE:
+				black[offset] |= mask
+			case RED_RED:
+				red[offset] |= mask
+			}
+		}
+	}
+
+	return black, red
+}
+
+// As prepare, but keeping colour: each of the red, green and blue planes is
+// turned and sized, then each pixel is matched to the nearest ink.
+func (p *Panel) prepare3Color(img image.Image, opts Options) []uint8 {
+	planes, w, h := colourPlanes(img)
+
+	ow, oh := w, h
+	for c := range planes {
+		planes[c], ow, oh = orient(planes[c], w, h, opts.Rotation, opts.MirrorHorizontal, opts.MirrorVertical)
+		planes[c] = fit(planes[c], ow, oh, p.Width, p.Height, opts.Fit, opts.Gravity)
+	}
+
+	return quantize3Color(planes, p.Width, p.Height, opts.Dither)
+}
+
+// Read the image as red, green and blue planes from 0 to 1, row-major, at its
+// own size. See greyPlane.
+func colourPlanes(img image.Image) ([3][]float32, int, int) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	planes := [3][]float32{make([]float32, w*h), make([]float32, w*h), make([]float32, w*h)}
+
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			c := color.RGBA64Model.Convert(img.At(bounds.Min.X+i, bounds.Min.Y+j)).(color.RGBA64)
+			planes[0][j*w+i] = float32(c.R) / 0xffff
+			planes[1][j*w+i] = float32(c.G) / 0xffff
+			planes[2][j*w+i] = float32(c.B) / 0xffff
+		}
+	}
+
+	return planes, w, h
+}
+
+// As quantize, matching each pixel to the nearest colour in redPalette by
+// distance in RGB. Greys are never nearest to red, so they reduce to black and
+// white exactly as they would on a two-colour panel.
+func quantize3Color(planes [3][]float32, width, height int, d Dither) []uint8 {
+	tones := make([]uint8, width*height)
+
+	var inks [3][3]float32
+	for t, c := range redPalette {
+		r, g, b, _ := c.RGBA()
+		inks[t] = [3]float32{float32(r) / 0xffff, float32(g) / 0xffff, float32(b) / 0xffff}
+	}
+
+	k, diffuse := kernels[d]
+
+	if diffuse {
+		for c := range planes {
+			planes[c] = append([]float32(nil), planes[c]...)
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var v [3]float32
+			for c := range planes {
+				v[c] = planes[c][y*width+x]
+				if d == DitherBayer {
+					v[c] += (float32(bayer8[y%8][x%8])+0.5)/64 - 0.5
+				}
+			}
+
+			best, bestDist := 0, float32(0)
+			for t, ink := range inks {
+				var dist float32
+				for c := range ink {
+					dist += (v[c] - ink[c]) * (v[c] - ink[c])
+				}
+				if t == 0 || dist < bestDist {
+					best, bestDist = t, dist
+				}
+			}
+			tones[y*width+x] = uint8(best)
+
+			if !diffuse {
+				continue
+			}
+
+			for c := range planes {
+				err := v[c] - inks[best][c]
+				for _, s := range k.spread {
+					nx, ny := x+s.dx, y+s.dy
+					if nx < 0 || nx >= width || ny >= height {
+						continue
+					}
+					planes[c][ny*width+nx] += err * float32(s.weight) / float32(k.divisor)
+				}
+			}
+		}
+	}
+
+	return tones
+}
+
+// Unpack3Color turns planes from Convert3Color back into an image of how they
+// should look on the panel. Anything past the end of the planes is white.
+func (p *Panel) Unpack3Color(black, red []byte) *image.Paletted {
+	img := image.NewPaletted(p.Bounds(), redPalette)
+	widthByte, _ := p.bufferSize()
+
+	for j := 0; j < p.Height; j++ {
+		for i := 0; i < p.Width; i++ {
+			mask := byte(0x80) >> (uint32(i) % 8)
+			offset := (i / 8) + (j * widthByte)
+
+			switch {
+			case offset < len(red) && red[offset]&mask != 0:
+				img.SetColorIndex(i, j, RED_RED)
+			case offset >= len(black) || black[offset]&mask != 0:
+				img.SetColorIndex(i, j, RED_WHITE)
+			}
+		}
+	}
+
+	return img
+}
@@ -0,0 +1,102 @@
+package epd7in5v2
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// Bands of black, white, red, then colours that should land on each ink.
+func redTestImage() *image.RGBA {
+	bands := []color.RGBA{
+		{0x00, 0x00, 0x00, 0xFF},
+		{0xFF, 0xFF, 0xFF, 0xFF},
+		{0xFF, 0x00, 0x00, 0xFF},
+		{0x30, 0x20, 0x40, 0xFF}, // Dark purple: black
+		{0xC0, 0xC0, 0xB0, 0xFF}, // Light grey: white
+		{0xD0, 0x30, 0x20, 0xFF}, // Brick: red
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	for b, c := range bands {
+		band := image.Rect(0, b*EPD_HEIGHT/len(bands), EPD_WIDTH, (b+1)*EPD_HEIGHT/len(bands))
+		draw.Draw(img, band, &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+
+	return img
+}
+
+func TestConvert3ColorRoundTrip(t *testing.T) {
+	black, red := panel7in5bv2.Convert3Color(redTestImage(), Options{})
+	frame := panel7in5bv2.Unpack3Color(black, red)
+
+	want := []uint8{RED_BLACK, RED_WHITE, RED_RED, RED_BLACK, RED_WHITE, RED_RED}
+	for b, tone := range want {
+		y := b*EPD_HEIGHT/len(want) + 1
+		if got := frame.ColorIndexAt(10, y); got != tone {
+			t.Errorf("band %d is tone %d, want %d", b, got, tone)
+		}
+	}
+
+	// Rows are 100 bytes: red is 0 in the black plane and 1 in the red one
+	row := 2*EPD_HEIGHT/len(want) + 1
+	if black[row*100] != 0x00 || red[row*100] != 0xFF {
+		t.Errorf("red packed as black %02X, red %02X; want 00, FF", black[row*100], red[row*100])
+	}
+}
+
+func TestConvert3ColorInvert(t *testing.T) {
+	black, red := panel7in5bv2.Convert3Color(redTestImage(), Options{Invert: true})
+	frame := panel7in5bv2.Unpack3Color(black, red)
+
+	for b, tone := range []uint8{RED_WHITE, RED_BLACK, RED_RED} {
+		y := b*EPD_HEIGHT/6 + 1
+		if got := frame.ColorIndexAt(10, y); got != tone {
+			t.Errorf("inverted band %d is tone %d, want %d", b, got, tone)
+		}
+	}
+}
+
+func TestConvert3ColorDitherKeepsGreysBlackAndWhite(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, EPD_WIDTH, EPD_HEIGHT))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.Gray{Y: 0x80}}, image.Point{}, draw.Src)
+
+	for _, d := range []Dither{DitherFloydSteinberg, DitherBayer} {
+		_, red := panel7in5bv2.Convert3Color(img, Options{Dither: d})
+		for i, b := range red {
+			if b != 0 {
+				t.Fatalf("%s: mid grey put red in byte %d", d, i)
+			}
+		}
+	}
+}
+
+func TestDisplay3Color(t *testing.T) {
+	e, r := newTestPanel(t, panel7in5bv2)
+	ctx := context.Background()
+
+	if err := e.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	r.transfers = nil
+
+	if err := e.Show3Color(ctx, redTestImage()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "display_3color", dump(r.transfers))
+}
+
+func TestDisplay3ColorNeedsRed(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	black, red := panel7in5v2.Convert3Color(redTestImage(), Options{})
+	if err := e.Display3Color(context.Background(), black, red); err == nil {
+		t.Error("Display3Color should fail on a panel without red ink")
+	}
+	if len(r.transfers) != 0 {
+		t.Errorf("sent %d commands", len(r.transfers))
+	}
+}
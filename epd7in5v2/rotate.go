@@ -0,0 +1,74 @@
+package epd7in5v2
+
+import "fmt"
+
+// Rotation turns images clockwise before they're fitted to the panel, for
+// frames that hang in a different orientation than the panel's native
+// landscape. With 90 or 270, a portrait image fills a portrait-mounted panel.
+type Rotation int
+
+const (
+	Rotate0 Rotation = iota
+	Rotate90
+	Rotate180
+	Rotate270
+)
+
+func (r Rotation) String() string {
+	return fmt.Sprintf("%d°", int(r)*90)
+}
+
+// ParseRotation converts clockwise degrees (0, 90, 180 or 270, or negative
+// equivalents) from the config file to a Rotation.
+func ParseRotation(degrees int) (Rotation, error) {
+	if degrees%90 != 0 {
+		return Rotate0, fmt.Errorf("epd: rotation must be a multiple of 90, not %d", degrees)
+	}
+
+	return Rotation((degrees/90%4 + 4) % 4), nil
+}
+
+// Mirror and then rotate a w x h grey plane (see greyPlane). Returns the new
+// plane and its size, which is swapped for 90 and 270.
+func orient(plane []float32, w, h int, r Rotation, mirrorH, mirrorV bool) ([]float32, int, int) {
+	if r == Rotate0 && !mirrorH && !mirrorV {
+		return plane, w, h
+	}
+
+	dw, dh := w, h
+	if r == Rotate90 || r == Rotate270 {
+		dw, dh = h, w
+	}
+
+	out := make([]float32, len(plane))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Mirror within the source first
+			sx, sy := x, y
+			if mirrorH {
+				sx = w - 1 - x
+			}
+			if mirrorV {
+				sy = h - 1 - y
+			}
+
+			// Then find where the source pixel lands after turning clockwise
+			var nx, ny int
+			switch r {
+			case Rotate0:
+				nx, ny = x, y
+			case Rotate90:
+				nx, ny = h-1-y, x
+			case Rotate180:
+				nx, ny = w-1-x, h-1-y
+			case Rotate270:
+				nx, ny = y, w-1-x
+			}
+
+			out[ny*dw+nx] = plane[sy*w+sx]
+		}
+	}
+
+	return out, dw, dh
+}
@@ -0,0 +1,52 @@
+package epd7in5v2
+
+import "testing"
+
+func TestOrient(t *testing.T) {
+	// 3x2:
+	//   a b c
+	//   d e f
+	plane := []float32{1, 2, 3, 4, 5, 6}
+
+	cases := []struct {
+		rotation         Rotation
+		mirrorH, mirrorV bool
+		w, h             int
+		want             []float32
+	}{
+		{Rotate0, false, false, 3, 2, []float32{1, 2, 3, 4, 5, 6}},
+		{Rotate90, false, false, 2, 3, []float32{4, 1, 5, 2, 6, 3}},
+		{Rotate180, false, false, 3, 2, []float32{6, 5, 4, 3, 2, 1}},
+		{Rotate270, false, false, 2, 3, []float32{3, 6, 2, 5, 1, 4}},
+		{Rotate0, true, false, 3, 2, []float32{3, 2, 1, 6, 5, 4}},
+		{Rotate0, false, true, 3, 2, []float32{4, 5, 6, 1, 2, 3}},
+		{Rotate90, true, false, 2, 3, []float32{6, 3, 5, 2, 4, 1}},
+	}
+
+	for _, c := range cases {
+		got, w, h := orient(plane, 3, 2, c.rotation, c.mirrorH, c.mirrorV)
+		if w != c.w || h != c.h {
+			t.Errorf("%s h=%t v=%t: size %dx%d, want %dx%d", c.rotation, c.mirrorH, c.mirrorV, w, h, c.w, c.h)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%s h=%t v=%t: got %v, want %v", c.rotation, c.mirrorH, c.mirrorV, got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRotation(t *testing.T) {
+	for degrees, want := range map[int]Rotation{0: Rotate0, 90: Rotate90, 180: Rotate180, 270: Rotate270, -90: Rotate270, 360: Rotate0} {
+		got, err := ParseRotation(degrees)
+		if err != nil || got != want {
+			t.Errorf("ParseRotation(%d) = %v, %v; want %v", degrees, got, err, want)
+		}
+	}
+
+	if _, err := ParseRotation(45); err == nil {
+		t.Error("ParseRotation should reject 45")
+	}
+}
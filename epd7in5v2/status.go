@@ -0,0 +1,84 @@
+package epd7in5v2
+
+import (
+	"context"
+	"strings"
+)
+
+// Status is the controller's flag register, from GET_STATUS.
+type Status byte
+
+const (
+	StatusIdle     Status = 1 << iota // BUSY_N: not busy
+	StatusPowerOff                    // POF: power off sequence finished
+	StatusPowerOn                     // PON: power on sequence finished
+	StatusData                        // data_flag: new frame data received
+	StatusI2CBusy                     // I2C_BUSY: talking to an external sensor
+	StatusI2CError                    // I2C_ERR: external sensor didn't answer
+	StatusPartial                     // PTL_FLAG: in partial mode (PARTIAL_IN)
+)
+
+var statusNames = []struct {
+	flag Status
+	name string
+}{
+	{StatusIdle, "idle"},
+	{StatusPowerOff, "power-off"},
+	{StatusPowerOn, "power-on"},
+	{StatusData, "data"},
+	{StatusI2CBusy, "i2c-busy"},
+	{StatusI2CError, "i2c-error"},
+	{StatusPartial, "partial"},
+}
+
+// Lists the flags that are set, e.g. "idle|power-on".
+func (s Status) String() string {
+	var flags []string
+	for _, f := range statusNames {
+		if s&f.flag != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+
+	if len(flags) == 0 {
+		return "busy"
+	}
+	return strings.Join(flags, "|")
+}
+
+// Status reads the controller's flags. Unlike most calls it doesn't wait for
+// BUSY, so it works on a panel that seems stuck.
+// Like Temperature, it needs a Config that can read replies.
+func (e *Epd) Status(ctx context.Context) (Status, error) {
+	if err := e.requireReads(); err != nil {
+		return 0, err
+	}
+	if err := e.sendCommand(GET_STATUS); err != nil {
+		return 0, err
+	}
+
+	reply, err := e.read(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return Status(reply[0]), nil
+}
+
+// Length of the reply to REVISION.
+const revisionLength = 7
+
+// Revision reads the controller's revision bytes. The datasheet says little
+// about what they mean, but a live controller answers with something other
+// than all 0x00 or all 0xFF, which is what a floating or shorted data line
+// reads as. Doesn't wait for BUSY.
+func (e *Epd) Revision(ctx context.Context) ([]byte, error) {
+	if err := e.requireReads(); err != nil {
+		return nil, err
+	}
+	if err := e.sendCommand(REVISION); err != nil {
+		return nil, err
+	}
+
+	return e.read(revisionLength)
+}
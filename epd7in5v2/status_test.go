@@ -0,0 +1,56 @@
+package epd7in5v2
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	e, r := newTestEpd(t)
+	r.replies = map[byte][]byte{GET_STATUS: {0x05}}
+
+	got, err := e.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != StatusIdle|StatusPowerOn {
+		t.Errorf("Status() = %s, want idle|power-on", got)
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	tests := []struct {
+		s    Status
+		want string
+	}{
+		{0, "busy"},
+		{StatusIdle | StatusPowerOff, "idle|power-off"},
+		{StatusPowerOn | StatusPartial, "power-on|partial"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.s.String(); got != tt.want {
+			t.Errorf("Status(%#02x).String() = %q, want %q", byte(tt.s), got, tt.want)
+		}
+	}
+}
+
+func TestRevision(t *testing.T) {
+	e, r := newTestEpd(t)
+	want := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07}
+	r.replies = map[byte][]byte{REVISION: want}
+
+	got, err := e.Revision(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Revision() = % X, want % X", got, want)
+	}
+
+	// Nothing is written after the command byte
+	if data := r.last(REVISION); len(data) != 0 {
+		t.Errorf("sent % X with REVISION", data)
+	}
+}
@@ -0,0 +1,60 @@
+package epd7in5v2
+
+import (
+	"context"
+	"fmt"
+)
+
+// Operating range of the panel from the spec, in °C. Outside it the built-in
+// waveforms aren't tuned and images may come out faint or streaky.
+const (
+	MIN_TEMPERATURE = 0
+	MAX_TEMPERATURE = 50
+)
+
+// Temperature reads the controller's built-in sensor, in °C. Requires Init,
+// and a Config that can read replies (ThreeWire or MISO).
+func (e *Epd) Temperature(ctx context.Context) (float64, error) {
+	if err := e.requireReads(); err != nil {
+		return 0, err
+	}
+
+	// The controller holds BUSY low while it takes the reading
+	if err := e.commandAndWait(ctx, TEMPERATURE_SENSOR_COMMAND); err != nil {
+		return 0, err
+	}
+
+	reply, err := e.read(2)
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeTemperature(reply[0], reply[1]), nil
+}
+
+// The sensor gives an 11-bit two's complement value in eighths of a degree,
+// left-aligned over two bytes: whole degrees in the first, and the fraction in
+// the top three bits of the second.
+func decodeTemperature(hi, lo byte) float64 {
+	return float64(int16(uint16(hi)<<8|uint16(lo))>>5) / 8
+}
+
+// ForceTemperature makes the controller pick its waveform for the given
+// temperature instead of the sensor's reading, until the next Init. Useful to
+// keep to the in-range waveforms when the panel is too hot or cold.
+func (e *Epd) ForceTemperature(ctx context.Context, celsius int) error {
+	if err := e.require(FeatureSensor); err != nil {
+		return err
+	}
+	if celsius < -128 || celsius > 127 {
+		return fmt.Errorf("epd: can't force a temperature of %d°C", celsius)
+	}
+
+	// See InitPartial
+	if err := e.command(CASCADE_SETTING, 0x02); err != nil {
+		return err
+	}
+
+	e.fast = false
+	return e.commandAndWait(ctx, FORCE_TEMPERATURE, byte(int8(celsius)))
+}
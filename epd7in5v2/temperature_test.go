@@ -0,0 +1,84 @@
+package epd7in5v2
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDecodeTemperature(t *testing.T) {
+	tests := []struct {
+		hi, lo byte
+		want   float64
+	}{
+		{0x00, 0x00, 0},
+		{0x19, 0x00, 25},
+		{0x19, 0x80, 25.5},
+		{0x32, 0x20, 50.125},
+		{0xFF, 0x00, -1},
+		{0xE7, 0x00, -25},
+		{0xF6, 0x60, -9.625},
+	}
+
+	for _, tt := range tests {
+		if got := decodeTemperature(tt.hi, tt.lo); got != tt.want {
+			t.Errorf("decodeTemperature(%02X, %02X) = %v, want %v", tt.hi, tt.lo, got, tt.want)
+		}
+	}
+}
+
+func TestTemperature(t *testing.T) {
+	e, r := newTestEpd(t)
+	r.replies = map[byte][]byte{TEMPERATURE_SENSOR_COMMAND: {0x15, 0x40}}
+
+	got, err := e.Temperature(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 21.25 {
+		t.Errorf("Temperature() = %v, want 21.25", got)
+	}
+}
+
+func TestTemperatureReadError(t *testing.T) {
+	e, r := newTestEpd(t)
+	r.failAt = 2 // The command goes through, the read fails
+
+	if _, err := e.Temperature(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// Without 3-wire SPI or MISO, the sensor reads as unavailable and nothing is
+// sent to the panel.
+func TestTemperatureWriteOnly(t *testing.T) {
+	e, r := newTestEpd(t)
+	e.readable = false
+
+	if e.Supports(FeatureSensor) {
+		t.Error("write-only panel claims to support sensor readback")
+	}
+	if _, err := e.Temperature(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := e.Status(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(r.transfers) != 0 {
+		t.Errorf("sent %d commands", len(r.transfers))
+	}
+}
+
+func TestForceTemperature(t *testing.T) {
+	e, r := newTestEpd(t)
+
+	if err := e.ForceTemperature(context.Background(), -5); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.last(FORCE_TEMPERATURE); len(got) != 1 || got[0] != 0xFB {
+		t.Errorf("FORCE_TEMPERATURE data is % X, want FB", got)
+	}
+
+	if err := e.ForceTemperature(context.Background(), 200); err == nil {
+		t.Error("expected an error forcing 200°C")
+	}
+}
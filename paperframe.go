@@ -1,36 +1,67 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"image"
-	"image/gif"
-	"image/jpeg"
-	"io"
 	"log"
-	"net/http"
+	"math"
 	"os"
 	"os/signal"
-	"runtime"
+	"path/filepath"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"tsmith512/epd7in5v2"
+	"tsmith512/paperframe/api"
 
 	"github.com/spf13/viper"
 )
 
 var API_ENDPOINT string
+var API_RETRY api.RetryPolicy
+var API_TIMEOUT time.Duration
 var CHECK_FREQ int
 var CLEAR_AFTER int
 var DEBUG bool
+var DISPLAY_ATTEMPTS int
+var DISPLAY_CLEAN_AT string
+var DISPLAY_CLEAN_EVERY int
+var DISPLAY_DRIVER string
+var DISPLAY_FULL_REFRESH_EVERY int
+var DISPLAY_GRAYSCALE bool
+var DISPLAY_MODE string
+var DISPLAY_OPTIONS epd7in5v2.Options
+var DISPLAY_OUT_OF_RANGE string
+var DISPLAY_PANEL *epd7in5v2.Panel
+var DISPLAY_TIMEOUT time.Duration
+var DISPLAY_TRICOLOR bool
+var SIMULATOR_DIR string
+var STATE_FILE string
 var VERSION string
 
+// Talks to API_ENDPOINT, set up in run()
+var apiClient *api.Client
+
+// Running count of failed screen refreshes, for spotting flaky hardware
+var displayErrors atomic.Int64
+
+// Full refreshes in a deep clean: black, white, negative and image
+const cleanRefreshes = 4
+
+// Last reading from the panel's temperature sensor in °C, or NaN if unknown
+var panelTemperature = math.NaN()
+
 const README = `
 Usage: paperframe <command>
 
 Supported commands:
   clear        Clear the screen to white
   current      Download the current image and display it
+  diagnose     Check that the screen's controller is answering
   display [id] Download a specific image ID and display it
   service      Display images, updating hourly, clear on TERM/INT.
   version      Print version number and exit.
@@ -52,8 +83,42 @@ func run() int {
 	viper.AddConfigPath("$HOME/.paperframe")
 	viper.SetDefault("api.endpoint", "https://paperframes.net/api")
 	viper.SetDefault("api.frequency", 10)
+	viper.SetDefault("api.timeout", 30)
+	viper.SetDefault("api.retry_attempts", api.DefaultRetry.Attempts)
+	viper.SetDefault("api.retry_delay", int(api.DefaultRetry.BaseDelay/time.Second))
+	viper.SetDefault("api.retry_max_delay", int(api.DefaultRetry.MaxDelay/time.Second))
+	viper.SetDefault("api.retry_jitter", api.DefaultRetry.Jitter)
+	viper.SetDefault("api.retry_statuses", api.DefaultRetry.Statuses)
 	viper.SetDefault("debug", false)
 	viper.SetDefault("clear_after", 12)
+	viper.SetDefault("state_file", "/var/lib/paperframe/state.json")
+	viper.SetDefault("display.driver", "auto")
+	viper.SetDefault("display.model", epd7in5v2.DefaultConfig.Model)
+	viper.SetDefault("display.timeout", 60)
+	viper.SetDefault("display.attempts", 3)
+	viper.SetDefault("display.mode", "normal")
+	viper.SetDefault("display.full_refresh_every", 10)
+	viper.SetDefault("display.clean_every", 0)
+	viper.SetDefault("display.clean_at", "")
+	viper.SetDefault("display.out_of_range", "warn")
+	viper.SetDefault("display.pins.dc", epd7in5v2.DefaultConfig.DC)
+	viper.SetDefault("display.pins.cs", epd7in5v2.DefaultConfig.CS)
+	viper.SetDefault("display.pins.rst", epd7in5v2.DefaultConfig.RST)
+	viper.SetDefault("display.pins.busy", epd7in5v2.DefaultConfig.BUSY)
+	viper.SetDefault("display.spi_port", "")
+	viper.SetDefault("display.spi_speed", epd7in5v2.DefaultConfig.SPISpeed.String())
+	viper.SetDefault("display.spi_3wire", false)
+	viper.SetDefault("display.spi_miso", false)
+	viper.SetDefault("display.grayscale", false)
+	viper.SetDefault("display.tricolor", false)
+	viper.SetDefault("display.invert", false)
+	viper.SetDefault("display.rotation", 0)
+	viper.SetDefault("display.mirror_horizontal", false)
+	viper.SetDefault("display.mirror_vertical", false)
+	viper.SetDefault("display.fit", "contain")
+	viper.SetDefault("display.gravity", "center")
+	viper.SetDefault("display.dither", "none")
+	viper.SetDefault("display.simulator_dir", filepath.Join(os.TempDir(), "paperframe"))
 	err := viper.ReadInConfig()
 
 	if err != nil {
@@ -66,44 +131,121 @@ func run() int {
 	}
 
 	API_ENDPOINT = viper.GetString("api.endpoint")
+	API_TIMEOUT = time.Duration(viper.GetInt("api.timeout")) * time.Second
+	API_RETRY = api.RetryPolicy{
+		Attempts:  viper.GetInt("api.retry_attempts"),
+		BaseDelay: time.Duration(viper.GetInt("api.retry_delay")) * time.Second,
+		MaxDelay:  time.Duration(viper.GetInt("api.retry_max_delay")) * time.Second,
+		Jitter:    viper.GetFloat64("api.retry_jitter"),
+		Statuses:  viper.GetIntSlice("api.retry_statuses"),
+	}
 	CHECK_FREQ = viper.GetInt("api.frequency")
 	DEBUG = viper.GetBool("debug")
 	CLEAR_AFTER = viper.GetInt("clear_after")
+	STATE_FILE = viper.GetString("state_file")
+	DISPLAY_DRIVER = viper.GetString("display.driver")
+	DISPLAY_TIMEOUT = time.Duration(viper.GetInt("display.timeout")) * time.Second
+	DISPLAY_ATTEMPTS = viper.GetInt("display.attempts")
+	DISPLAY_MODE = viper.GetString("display.mode")
+	DISPLAY_FULL_REFRESH_EVERY = viper.GetInt("display.full_refresh_every")
+	DISPLAY_CLEAN_EVERY = viper.GetInt("display.clean_every")
+	DISPLAY_CLEAN_AT = viper.GetString("display.clean_at")
+	DISPLAY_OUT_OF_RANGE = viper.GetString("display.out_of_range")
+	DISPLAY_GRAYSCALE = viper.GetBool("display.grayscale")
+	DISPLAY_TRICOLOR = viper.GetBool("display.tricolor")
+	SIMULATOR_DIR = viper.GetString("display.simulator_dir")
+
+	DISPLAY_PANEL, err = epd7in5v2.LookupPanel(viper.GetString("display.model"))
+	if err != nil {
+		log.Printf("Fatal error loading config: %s", err)
+		return 1
+	}
 
-	if DEBUG {
-		log.Println("Verbose output for debugging")
+	DISPLAY_OPTIONS, err = displayOptions()
+	if err != nil {
+		log.Printf("Fatal error loading config: %s", err)
+		return 1
 	}
 
-	if len(os.Args) < 2 {
-		fmt.Print(README)
+	if DISPLAY_ATTEMPTS < 1 {
+		DISPLAY_ATTEMPTS = 1
+	}
+
+	if API_RETRY.Attempts < 1 {
+		API_RETRY.Attempts = 1
+	}
+
+	if API_RETRY.Jitter < 0 || API_RETRY.Jitter > 1 {
+		log.Printf("Fatal error loading config: api.retry_jitter should be from 0 to 1, got %g", API_RETRY.Jitter)
 		return 1
 	}
 
-	var epd *epd7in5v2.Epd
+	if DISPLAY_MODE != "normal" && DISPLAY_MODE != "fast" {
+		log.Printf("Fatal error loading config: unknown display mode '%s'", DISPLAY_MODE)
+		return 1
+	}
 
-	if runtime.GOARCH == "arm" {
-		// See pinout at https://www.waveshare.com/wiki/7.5inch_e-Paper_HAT_Manual#Hardware_connection
-		epd, err = epd7in5v2.New("P1_22", "P1_24", "P1_11", "P1_18")
+	switch DISPLAY_OUT_OF_RANGE {
+	case "warn", "clamp", "refuse":
+	default:
+		log.Printf("Fatal error loading config: unknown display.out_of_range '%s'", DISPLAY_OUT_OF_RANGE)
+		return 1
+	}
 
-		if err != nil || epd == nil {
-			// One of the test devices likes to fail to init the screen and gets stuck
-			// perpetually waiting for idle. But restarting the service will fix it...
-			log.Printf("Failed to initialize screen: %s", err)
+	if DISPLAY_CLEAN_AT != "" {
+		if _, err := time.Parse("15:04", DISPLAY_CLEAN_AT); err != nil {
+			log.Printf("Fatal error loading config: display.clean_at should be HH:MM, got '%s'", DISPLAY_CLEAN_AT)
 			return 1
 		}
-	} else {
-		log.Println("Skipping screen init: not running on compatible hardware")
 	}
 
+	apiClient = api.New(API_ENDPOINT, API_TIMEOUT, VERSION)
+	apiClient.Retry = API_RETRY
+	if DEBUG {
+		apiClient.Logf = log.Printf
+	}
+
+	if err := loadState(); err != nil {
+		// Not worth refusing to run over; the worst case is an early deep clean
+		log.Printf("Unable to load state from %s: %s", STATE_FILE, err)
+	}
+
+	if DEBUG {
+		log.Println("Verbose output for debugging")
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Print(README)
+		return 1
+	}
+
+	display, err := newDisplay(DISPLAY_DRIVER, DISPLAY_OPTIONS)
+	if err != nil {
+		// One of the test devices likes to fail to init the screen and gets stuck
+		// perpetually waiting for idle. But restarting the service will fix it...
+		log.Printf("Failed to initialize screen: %s", err)
+		return 1
+	}
+
+	// Whichever way run() returns, including the signal handler, put the panel
+	// to sleep and release the pins and SPI port
+	defer closeDisplay(display)
+
 	switch os.Args[1] {
 	case "version":
 		fmt.Printf("%s\n", VERSION)
 		return 0
 
 	case "clear":
-		displayClear(epd)
+		if err := displayClear(display); err != nil {
+			log.Println(err)
+			return 1
+		}
 		return 0
 
+	case "diagnose":
+		return diagnose(display)
+
 	case "current":
 		currentId, err := getCurrentId()
 		if err != nil {
@@ -117,7 +259,10 @@ func run() int {
 			return 1
 		}
 
-		displayImage(image, epd)
+		if err := displayImage(currentId, image, display); err != nil {
+			log.Println(err)
+			return 1
+		}
 		return 0
 
 	case "display":
@@ -132,26 +277,31 @@ func run() int {
 			return 1
 		}
 
-		displayImage(image, epd)
+		if err := displayImage(os.Args[2], image, display); err != nil {
+			log.Println(err)
+			return 1
+		}
 		return 0
 
 	case "service":
 		// Systemd has a nasty habit of starting this service after dhcpd has forked
 		// but not actually established an address so the initial image check fails.
-		// Wait until we have reached the API before moving into the service loop.
-		for i := 0; i <= 6; i += 1 {
-			if checkConnected() {
-				if DEBUG {
-					log.Println("Connection to API confirmed")
-				}
-				break
-			}
-			time.Sleep(10 * time.Second)
+		// Wait until we have reached the API (retrying per API_RETRY) before moving
+		// into the service loop.
+		if checkConnected() && DEBUG {
+			log.Println("Connection to API confirmed")
 		}
 
 		// Keep track of the last time we refreshed the screen
 		lastUpdated := time.Now()
 
+		// Count the time until the first scheduled deep clean from now, rather
+		// than running one straight away on a new install
+		if STATE.LastClean.IsZero() {
+			STATE.LastClean = lastUpdated
+			saveState()
+		}
+
 		// Start by determining what to show now
 		currentId, err := getCurrentId()
 		if err != nil {
@@ -164,9 +314,14 @@ func run() int {
 		}
 
 		if image != nil {
-			displayImage(image, epd)
+			if err := serviceDisplay(currentId, image, display, lastUpdated); err != nil {
+				log.Println(err)
+			}
 		}
 
+		// Kept for deep cleans between new images
+		currentImage := image
+
 		log.Printf("Waiting for next %d-minute check or exit signal.\n", CHECK_FREQ)
 
 		// Channels for system term/int signals and exit code for graceful shutdown
@@ -192,14 +347,17 @@ func run() int {
 						checkNewId, err := getCurrentId()
 
 						if err != nil || len(checkNewId) == 0 {
-							// HTTP Errors or Network transit errors would both be caught here
+							// HTTP Errors or Network transit errors would both be caught here,
+							// once the API client has used up its retries
 							log.Printf("-> Failed to fetch current ID")
 
 							if time.Since(lastUpdated).Hours() >= float64(CLEAR_AFTER) {
 								// This likely means the device has gone offline.
 								// @TODO: Do we want to show a message or start downloading files?
 								fmt.Printf("-> Display unchanged too long. Clearing to prevent burn-in.")
-								displayClear(epd)
+								if err := displayClear(display); err != nil {
+									log.Printf("-> Screen could not be cleared: %s", err)
+								}
 								lastUpdated = time.Now()
 							}
 
@@ -212,10 +370,19 @@ func run() int {
 							if DEBUG {
 								log.Printf("-> Current image already on display (%s)", currentId)
 							}
+							if currentImage != nil && cleanDue(currentTime) {
+								if err := displayDeepClean(currentId, currentImage, display); err != nil {
+									log.Printf("-> Screen could not be cleaned: %s", err)
+								}
+								lastUpdated = time.Now()
+								continue
+							}
 							if time.Since(lastUpdated).Hours() >= float64(CLEAR_AFTER) {
 								// This should not happen unless the Worker cron stopped...
 								fmt.Printf("-> Display unchanged too long. Clearing to prevent burn-in.")
-								displayClear(epd)
+								if err := displayClear(display); err != nil {
+									log.Printf("-> Screen could not be cleared: %s", err)
+								}
 								lastUpdated = time.Now()
 							}
 
@@ -235,7 +402,9 @@ func run() int {
 								// file itself... that is also a case I can't quite figure how
 								// we'd get to.
 								fmt.Printf("-> Display unchanged too long. Clearing to prevent burn-in.")
-								displayClear(epd)
+								if err := displayClear(display); err != nil {
+									log.Printf("-> Screen could not be cleared: %s", err)
+								}
 								lastUpdated = time.Now()
 							}
 
@@ -243,8 +412,20 @@ func run() int {
 						}
 
 						// New image downloaded; replace and update display
-						displayImage(image, epd)
+						if err := serviceDisplay(checkNewId, image, display, currentTime); err != nil {
+							log.Printf("-> Screen could not be updated: %s", err)
+
+							if errors.Is(err, context.DeadlineExceeded) {
+								// Resets didn't bring the panel back. Exit so systemd will
+								// restart the service, which has been known to fix it.
+								exit <- 1
+								return
+							}
+
+							continue
+						}
 						currentId = checkNewId
+						currentImage = image
 						lastUpdated = time.Now()
 					}
 
@@ -264,7 +445,9 @@ func run() int {
 			}
 
 			stopTicker <- true
-			displayClear(epd)
+			if err := displayClear(display); err != nil {
+				log.Printf("-> Screen could not be cleared: %s", err)
+			}
 			lastUpdated = time.Now()
 			exit <- 0
 		}()
@@ -279,40 +462,20 @@ func run() int {
 
 // Fetch the current ID from the API.
 func getCurrentId() (string, error) {
-	data, err := http.Get(API_ENDPOINT + "/now/id")
-
+	id, err := apiClient.CurrentID(context.Background(), panelTemperature)
 	if err != nil {
-		// Some kind of networking error (we didn't even get an HTTP response)
 		if DEBUG {
-			log.Printf("Unable to fetch current image ID: %#v", err)
+			log.Printf("Unable to fetch current image ID: %s", err)
 		}
-		return "", errors.New("Unable to fetch current ID. (Networking error)")
+		return "", fmt.Errorf("Unable to fetch current ID: %w", err)
 	}
 
-	if data.StatusCode != 200 {
-		if DEBUG {
-			log.Printf("Couldn't fetch current image ID. HTTP %d.", data.StatusCode)
-		}
-		return "", errors.New(fmt.Sprintf("Unable to fetch current ID. (HTTP %d)", data.StatusCode))
-	}
-
-	id, err := io.ReadAll(data.Body)
-	if err != nil {
-		if DEBUG {
-			log.Printf("Couldn't decode response: %s.", string(id))
-		}
-
-		return "", errors.New("Unable to decode API response body for current ID.")
-	}
-
-	return string(id), nil
+	return id, nil
 }
 
 // Fetch an image to display.
 // Backwards compatiblility: if id == "", look up current ID and use that.
 func getImage(id string) (image.Image, error) {
-	var path string
-
 	if id == "" {
 		var err error
 		id, err = getCurrentId()
@@ -321,131 +484,396 @@ func getImage(id string) (image.Image, error) {
 		}
 	}
 
-	path = "/image/" + id
+	image, err := apiClient.Image(context.Background(), id)
+	if err != nil {
+		if DEBUG {
+			log.Printf("Unable to fetch image '%s': %s", id, err)
+		}
+		return nil, fmt.Errorf("Unable to fetch image: %w", err)
+	}
 
-	data, err := http.Get(API_ENDPOINT + path)
+	return image, nil
+}
 
-	if err != nil {
-		// Some kind of networking error (we didn't even get an HTTP response)
+func checkConnected() bool {
+	if err := apiClient.Ping(context.Background()); err != nil {
 		if DEBUG {
-			log.Printf("Unable to fetch image at '%s': %#v", path, err)
+			log.Printf("Connection check error: %s", err)
 		}
-		return nil, errors.New("Unable to fetch image. (Networking error)")
+		return false
 	}
-	if data.StatusCode != 200 {
+
+	return true
+}
+
+func displayImage(id string, image image.Image, display Display) error {
+	if display == nil {
 		if DEBUG {
-			log.Printf("Couldn't fetch image at '%s'. HTTP %d.", path, data.StatusCode)
+			log.Println("Screen unavailable: skipping display")
 		}
-		return nil, errors.New(fmt.Sprintf("Unable to fetch image. (HTTP %d)", data.StatusCode))
+		return nil
 	}
 
-	image, err := decodeImage(data.Body, data.Header.Get("Content-Type"))
-	if err != nil {
-		return nil, err
-	} else {
-		return image, nil
+	if l, ok := display.(labeler); ok {
+		l.SetLabel(id)
 	}
-}
 
-func checkConnected() bool {
-	res, err := http.Get(API_ENDPOINT)
+	// Convert the image once, then fingerprint and paint the same buffers
+	init := display.Init
+	var buffers [][]byte
+	var paint func(ctx context.Context) error
+	fast := false
+
+	if DISPLAY_TRICOLOR {
+		if r, ok := display.(redDisplay); ok && supports(display, epd7in5v2.FeatureRed) {
+			black, red := r.Convert3Color(image)
+			buffers = [][]byte{black, red}
+			paint = func(ctx context.Context) error {
+				return r.Display3Color(ctx, black, red)
+			}
+		} else if DEBUG {
+			log.Println("Screen has no red: ignoring display.tricolor")
+		}
+	}
 
-	if err != nil {
-		if DEBUG {
-			log.Printf("Connection check error: %#v", err)
+	// Panels without red can still use the other modes
+	if paint == nil && DISPLAY_GRAYSCALE {
+		if g, ok := display.(grayDisplay); ok && supports(display, epd7in5v2.FeatureGray) {
+			init = g.Init4Gray
+			oldData, newData := g.Convert4Gray(image)
+			buffers = [][]byte{oldData, newData}
+			paint = func(ctx context.Context) error {
+				return g.Display4Gray(ctx, oldData, newData)
+			}
+		} else if DEBUG {
+			log.Println("Screen can't show greyscale: using black and white")
+		}
+	} else if paint == nil && DISPLAY_MODE == "fast" {
+		if f, ok := display.(fastDisplay); ok && supports(display, epd7in5v2.FeatureFast) {
+			// Every so often do a normal refresh to clear the ghosting
+			if STATE.FastUpdates < DISPLAY_FULL_REFRESH_EVERY {
+				init = f.InitFast
+				fast = true
+			} else if DEBUG {
+				log.Printf("-> %d fast updates since the last full refresh: doing a full one", STATE.FastUpdates)
+			}
+		} else if DEBUG {
+			log.Println("Screen has no fast mode: using a normal refresh")
+		}
+	}
+
+	if paint == nil {
+		frame := display.Frame(image)
+		buffers = [][]byte{frame}
+		paint = func(ctx context.Context) error {
+			return display.Display(ctx, frame)
 		}
-		return false
 	}
 
-	if res.StatusCode > 300 {
+	// The same picture can come back under a new ID, or be asked for again from
+	// the command line. The panel holds it without power, so leave it be.
+	frame := frameHash(buffers...)
+	if frame == STATE.Frame {
 		if DEBUG {
-			log.Printf("Connection check HTTP %d: %#v", res.StatusCode, res)
+			log.Println("-> Frame already on display: skipping refresh")
 		}
-		return false
+		return nil
 	}
 
-	return true
+	if err := refresh(display, DISPLAY_TIMEOUT, init, "Displaying", paint); err != nil {
+		// Can't be sure what's on screen now
+		STATE.Frame = ""
+		saveState()
+		return err
+	}
+
+	// Any other paint, including a fallback from fast mode, is a full refresh
+	if fast {
+		STATE.FastUpdates++
+	} else {
+		STATE.FastUpdates = 0
+	}
+
+	STATE.RefreshesSinceClean++
+	STATE.Frame = frame
+	saveState()
+	return nil
 }
 
-// Decode GIF or JPEG image given a mimeType
-func decodeImage(data io.Reader, mimeType string) (image.Image, error) {
-	switch mimeType {
-	case "image/gif":
-		image, err := gif.Decode(data)
-		if err != nil {
-			log.Printf("Error decoding GIF: %s", err)
-			return nil, err
-		}
-		return image, nil
+// Fingerprint the buffers the panel receives for an image, so a repeat can be
+// spotted whatever its ID.
+func frameHash(buffers ...[]byte) string {
+	h := sha256.New()
+	for _, b := range buffers {
+		h.Write(b)
+	}
 
-	case "image/jpg", "image/jpeg":
-		image, err := jpeg.Decode(data)
-		if err != nil {
-			log.Printf("Error decoding JPEG: %s", err)
-			return nil, err
-		}
-		return image, nil
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	default:
-		log.Printf("Image type indeterminate or unsupported")
-		return nil, errors.New("Image type indeterminate or unsupported")
+// Show an image from the service, running the deep clean on the way if one is
+// due.
+func serviceDisplay(id string, image image.Image, display Display, now time.Time) error {
+	if cleanDue(now) {
+		return displayDeepClean(id, image, display)
 	}
+	return displayImage(id, image, display)
 }
 
-func displayImage(image image.Image, epd *epd7in5v2.Epd) {
-	if epd == nil {
+// Whether a deep clean is due, either by DISPLAY_CLEAN_EVERY refreshes or by
+// passing the DISPLAY_CLEAN_AT time of day since the last one.
+func cleanDue(now time.Time) bool {
+	if now.Before(STATE.CleanRetryAt) {
+		return false
+	}
+
+	if DISPLAY_CLEAN_EVERY > 0 && STATE.RefreshesSinceClean >= DISPLAY_CLEAN_EVERY {
+		return true
+	}
+
+	if DISPLAY_CLEAN_AT == "" {
+		return false
+	}
+
+	// Already validated in run()
+	at, _ := time.Parse("15:04", DISPLAY_CLEAN_AT)
+
+	// The most recent time it was clean_at o'clock
+	scheduled := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if now.Before(scheduled) {
+		scheduled = scheduled.AddDate(0, 0, -1)
+	}
+
+	return STATE.LastClean.Before(scheduled)
+}
+
+// How long to leave the panel alone after the nth deep clean in a row fails:
+// an hour, doubling up to a day.
+func cleanBackoff(failures int) time.Duration {
+	backoff := time.Hour
+	for i := 1; i < failures && backoff < 24*time.Hour; i++ {
+		backoff *= 2
+	}
+
+	if backoff > 24*time.Hour {
+		backoff = 24 * time.Hour
+	}
+	return backoff
+}
+
+// Run the display's anti-ghosting cycle (black, white, a negative of the image,
+// then the image) and note it in STATE. Displays without one just show the
+// image.
+func displayDeepClean(id string, image image.Image, display Display) error {
+	if display == nil {
 		if DEBUG {
-			log.Println("Screen unavailable: skipping display")
+			log.Println("Screen unavailable: skipping deep clean")
 		}
-		return
+		return nil
 	}
 
-	if DEBUG {
-		log.Println("-> Reset")
+	c, ok := display.(cleaner)
+	if !ok {
+		if DEBUG {
+			log.Println("Screen has no deep clean: displaying normally")
+		}
+		return displayImage(id, image, display)
 	}
-	epd.Reset()
 
-	if DEBUG {
-		log.Println("-> Init")
+	if l, ok := display.(labeler); ok {
+		l.SetLabel(id)
 	}
-	epd.Init()
 
-	if DEBUG {
-		log.Println("-> Displaying")
+	// Convert once, and remember the frame the cycle ends on
+	frame := display.Frame(image)
+	paint := func(ctx context.Context) error {
+		return c.DeepCleanFrame(ctx, frame)
+	}
+	// Allow each of the cycle's full refreshes as long as a normal one
+	if err := refresh(display, DISPLAY_TIMEOUT*cleanRefreshes, display.Init, "Deep clean", paint); err != nil {
+		// The cycle may have stopped on black, white or the negative
+		STATE.Frame = ""
+
+		// Don't wear the panel out with another attempt every check
+		STATE.CleanFailures++
+		STATE.CleanRetryAt = time.Now().Add(cleanBackoff(STATE.CleanFailures))
+		saveState()
+		log.Printf("-> Deep clean failed: not trying again until %s", STATE.CleanRetryAt.Format("Jan 2 15:04"))
+		return err
+	}
+
+	STATE.CleanFailures = 0
+	STATE.CleanRetryAt = time.Time{}
+	STATE.FastUpdates = 0
+	STATE.RefreshesSinceClean = 0
+	STATE.LastClean = time.Now()
+	STATE.Frame = frameHash(frame)
+	saveState()
+
+	// The cycle ends on a black and white version of the image
+	if DISPLAY_GRAYSCALE || DISPLAY_TRICOLOR {
+		return displayImage(id, image, display)
+	}
+	return nil
+}
+
+// Release the screen on the way out.
+func closeDisplay(display Display) {
+	if display == nil {
+		return
 	}
-	epd.Display(epd.Convert(image))
 
 	if DEBUG {
-		log.Println("-> Sleep")
+		log.Println("-> Close")
+	}
+	if err := display.Close(); err != nil {
+		log.Printf("Screen could not be closed: %s", err)
 	}
-	epd.Sleep()
 }
 
-func displayClear(epd *epd7in5v2.Epd) {
-	if epd == nil {
+func displayClear(display Display) error {
+	if display == nil {
 		if DEBUG {
 			log.Println("Screen unavailable: skipping clear")
 		}
-		return
+		return nil
+	}
+
+	if err := refresh(display, DISPLAY_TIMEOUT, display.Init, "Clear", display.Clear); err != nil {
+		STATE.Frame = ""
+		saveState()
+		return err
+	}
+
+	// A clear is a full refresh too
+	STATE.FastUpdates = 0
+	STATE.Frame = ""
+	saveState()
+	return nil
+}
+
+// Wake the screen with init, run one paint step on it, and put it back to
+// sleep. If the panel gets stuck busy past timeout (normally DISPLAY_TIMEOUT),
+// hard-reset it and start over, up to DISPLAY_ATTEMPTS times.
+func refresh(display Display, timeout time.Duration, init func(ctx context.Context) error, step string, paint func(ctx context.Context) error) error {
+	var err error
+
+	for attempt := 1; attempt <= DISPLAY_ATTEMPTS; attempt++ {
+		err = refreshOnce(display, timeout, init, step, paint)
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("-> Screen error (%d since start): %s", displayErrors.Add(1), err)
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+
+		log.Printf("-> Screen timed out (attempt %d of %d)", attempt, DISPLAY_ATTEMPTS)
 	}
 
+	return err
+}
+
+func refreshOnce(display Display, timeout time.Duration, init func(ctx context.Context) error, step string, paint func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
 	if DEBUG {
 		log.Println("-> Reset")
 	}
-	epd.Reset()
+	if err := display.Reset(); err != nil {
+		return err
+	}
 
 	if DEBUG {
 		log.Println("-> Init")
 	}
-	epd.Init()
+	if err := init(ctx); err != nil {
+		return err
+	}
+
+	if err := checkTemperature(ctx, display); err != nil {
+		return sleepAfter(display, err)
+	}
 
 	if DEBUG {
-		log.Println("-> Clear")
+		log.Printf("-> %s", step)
+	}
+	if err := paint(ctx); err != nil {
+		return sleepAfter(display, err)
 	}
-	epd.Clear()
 
 	if DEBUG {
 		log.Println("-> Sleep")
 	}
-	epd.Sleep()
+	return display.Sleep(ctx)
+}
+
+// How long to wait for the panel to power down after a refresh goes wrong.
+const sleepTimeout = 10 * time.Second
+
+// Put the panel back to sleep after init powered it on but the refresh failed
+// with err, so it isn't left powered until the next one. Returns err.
+func sleepAfter(display Display, err error) error {
+	// The refresh's own context may be what ran out
+	ctx, cancel := context.WithTimeout(context.Background(), sleepTimeout)
+	defer cancel()
+
+	if DEBUG {
+		log.Println("-> Sleep")
+	}
+	if serr := display.Sleep(ctx); serr != nil {
+		log.Printf("-> Screen could not be put to sleep: %s", serr)
+	}
+
+	return err
+}
+
+// Read and log the panel's temperature, if it has a sensor. Outside the
+// panel's operating range, warn, force the waveform for the nearest end of the
+// range, or refuse to refresh, per DISPLAY_OUT_OF_RANGE.
+func checkTemperature(ctx context.Context, display Display) error {
+	t, ok := display.(thermometer)
+	if !ok || !supports(display, epd7in5v2.FeatureSensor) {
+		return nil
+	}
+
+	celsius, err := t.Temperature(ctx)
+	if err != nil {
+		panelTemperature = math.NaN()
+
+		if ctx.Err() != nil {
+			return err
+		}
+
+		// Not worth missing an update over
+		log.Printf("-> Unable to read panel temperature: %s", err)
+		return nil
+	}
+
+	panelTemperature = celsius
+	log.Printf("-> Panel temperature %.1f°C", celsius)
+
+	if celsius >= epd7in5v2.MIN_TEMPERATURE && celsius <= epd7in5v2.MAX_TEMPERATURE {
+		return nil
+	}
+
+	switch DISPLAY_OUT_OF_RANGE {
+	case "refuse":
+		return fmt.Errorf("Panel is at %.1f°C, outside its %d-%d°C operating range", celsius, epd7in5v2.MIN_TEMPERATURE, epd7in5v2.MAX_TEMPERATURE)
+
+	case "clamp":
+		clamped := epd7in5v2.MIN_TEMPERATURE
+		if celsius > epd7in5v2.MAX_TEMPERATURE {
+			clamped = epd7in5v2.MAX_TEMPERATURE
+		}
+		log.Printf("-> Panel is outside its operating range: refreshing as if at %d°C", clamped)
+		return t.ForceTemperature(ctx, clamped)
+
+	default:
+		log.Printf("-> Panel is outside its %d-%d°C operating range: the image may come out faint", epd7in5v2.MIN_TEMPERATURE, epd7in5v2.MAX_TEMPERATURE)
+		return nil
+	}
 }
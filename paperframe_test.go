@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Replace STATE and the deep clean settings for one test.
+func withCleanConfig(t *testing.T, every int, at string, state State) {
+	t.Helper()
+
+	oldState, oldEvery, oldAt := STATE, DISPLAY_CLEAN_EVERY, DISPLAY_CLEAN_AT
+	t.Cleanup(func() {
+		STATE, DISPLAY_CLEAN_EVERY, DISPLAY_CLEAN_AT = oldState, oldEvery, oldAt
+	})
+
+	STATE, DISPLAY_CLEAN_EVERY, DISPLAY_CLEAN_AT = state, every, at
+}
+
+func TestCleanDue(t *testing.T) {
+	day := func(d, h, m int) time.Time {
+		return time.Date(2026, time.March, d, h, m, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		name  string
+		every int
+		at    string
+		state State
+		now   time.Time
+		want  bool
+	}{
+		{"never", 0, "", State{RefreshesSinceClean: 1000}, day(2, 12, 0), false},
+
+		{"before clean_every", 10, "", State{RefreshesSinceClean: 9}, day(2, 12, 0), false},
+		{"reached clean_every", 10, "", State{RefreshesSinceClean: 10}, day(2, 12, 0), true},
+
+		{"before clean_at", 0, "04:00", State{LastClean: day(1, 4, 30)}, day(2, 3, 59), false},
+		{"at clean_at", 0, "04:00", State{LastClean: day(1, 4, 30)}, day(2, 4, 0), true},
+		{"after clean_at", 0, "04:00", State{LastClean: day(1, 4, 30)}, day(2, 18, 0), true},
+		{"cleaned since clean_at", 0, "04:00", State{LastClean: day(2, 4, 5)}, day(2, 23, 0), false},
+
+		// Just past midnight, the most recent clean_at is yesterday's
+		{"after midnight, cleaned yesterday", 0, "04:00", State{LastClean: day(1, 4, 10)}, day(2, 0, 30), false},
+		{"after midnight, missed yesterday", 0, "23:30", State{LastClean: day(1, 12, 0)}, day(2, 0, 15), true},
+		{"before late clean_at", 0, "23:30", State{LastClean: day(1, 23, 45)}, day(2, 23, 0), false},
+
+		{"retry not yet due", 10, "", State{RefreshesSinceClean: 10, CleanFailures: 1, CleanRetryAt: day(2, 13, 0)}, day(2, 12, 0), false},
+		{"retry due", 10, "", State{RefreshesSinceClean: 10, CleanFailures: 1, CleanRetryAt: day(2, 13, 0)}, day(2, 13, 0), true},
+		{"retry not yet due for clean_at", 0, "04:00", State{LastClean: day(1, 4, 0), CleanFailures: 2, CleanRetryAt: day(2, 6, 0)}, day(2, 5, 0), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			withCleanConfig(t, c.every, c.at, c.state)
+
+			if got := cleanDue(c.now); got != c.want {
+				t.Errorf("cleanDue(%s) = %t, want %t", c.now.Format("Jan 2 15:04"), got, c.want)
+			}
+		})
+	}
+}
+
+func TestCleanBackoff(t *testing.T) {
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Hour},
+		{2, 2 * time.Hour},
+		{3, 4 * time.Hour},
+		{5, 16 * time.Hour},
+		{6, 24 * time.Hour},
+		{7, 24 * time.Hour},
+		{1000, 24 * time.Hour},
+	}
+
+	for _, c := range cases {
+		if got := cleanBackoff(c.failures); got != c.want {
+			t.Errorf("cleanBackoff(%d) = %s, want %s", c.failures, got, c.want)
+		}
+	}
+}
+
+// Set up the display settings for painting to a simulator, with STATE and
+// STATE_FILE in a temporary directory.
+func withDisplayConfig(t *testing.T) {
+	t.Helper()
+
+	oldState, oldFile := STATE, STATE_FILE
+	oldTimeout, oldAttempts, oldMode := DISPLAY_TIMEOUT, DISPLAY_ATTEMPTS, DISPLAY_MODE
+	oldGray, oldRed, oldFullEvery := DISPLAY_GRAYSCALE, DISPLAY_TRICOLOR, DISPLAY_FULL_REFRESH_EVERY
+	t.Cleanup(func() {
+		STATE, STATE_FILE = oldState, oldFile
+		DISPLAY_TIMEOUT, DISPLAY_ATTEMPTS, DISPLAY_MODE = oldTimeout, oldAttempts, oldMode
+		DISPLAY_GRAYSCALE, DISPLAY_TRICOLOR, DISPLAY_FULL_REFRESH_EVERY = oldGray, oldRed, oldFullEvery
+	})
+
+	STATE, STATE_FILE = State{}, filepath.Join(t.TempDir(), "state.json")
+	DISPLAY_TIMEOUT, DISPLAY_ATTEMPTS, DISPLAY_MODE = time.Second, 1, "normal"
+	DISPLAY_GRAYSCALE, DISPLAY_TRICOLOR, DISPLAY_FULL_REFRESH_EVERY = false, false, 10
+}
+
+// Number of frames the simulator has saved.
+func simulatorFrames(t *testing.T, s *Simulator) int {
+	t.Helper()
+
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+func TestDisplayImageSkipsUnchangedFrame(t *testing.T) {
+	withDisplayConfig(t)
+	s := newTestSimulator(t)
+	img := image.NewGray(s.Bounds())
+
+	if err := displayImage("abc", img, s); err != nil {
+		t.Fatal(err)
+	}
+	if STATE.Frame == "" {
+		t.Fatal("frame on display not recorded")
+	}
+
+	// The same picture again, under another ID
+	if err := displayImage("def", img, s); err != nil {
+		t.Fatal(err)
+	}
+	if n := simulatorFrames(t, s); n != 1 {
+		t.Errorf("painted %d frames, want the repeat skipped", n)
+	}
+}
+
+// A simulator whose deep clean gives up partway.
+type failingCleaner struct {
+	*Simulator
+}
+
+func (f failingCleaner) DeepCleanFrame(ctx context.Context, frame []byte) error {
+	return errors.New("stopped on the negative")
+}
+
+func TestFailedDeepCleanForgetsFrame(t *testing.T) {
+	withDisplayConfig(t)
+	s := newTestSimulator(t)
+	display := failingCleaner{s}
+	img := image.NewGray(s.Bounds())
+
+	if err := displayImage("abc", img, display); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if err := displayDeepClean("abc", img, display); err == nil {
+		t.Fatal("expected an error")
+	}
+	if STATE.Frame != "" {
+		t.Error("frame on display still recorded after a failed clean")
+	}
+	if STATE.CleanFailures != 1 || !STATE.CleanRetryAt.After(now) {
+		t.Errorf("failed clean not backed off: %d failures, retry at %s", STATE.CleanFailures, STATE.CleanRetryAt)
+	}
+
+	// So the image is painted again rather than skipped
+	if err := displayImage("abc", img, display); err != nil {
+		t.Fatal(err)
+	}
+	if n := simulatorFrames(t, s); n != 2 {
+		t.Errorf("painted %d frames, want the image repainted", n)
+	}
+}
+
+func TestDeepCleanRecordsFrame(t *testing.T) {
+	withDisplayConfig(t)
+	s := newTestSimulator(t)
+	img := image.NewGray(s.Bounds())
+
+	if err := displayDeepClean("abc", img, s); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cycle ended on the image, so it isn't painted again
+	if err := displayImage("abc", img, s); err != nil {
+		t.Fatal(err)
+	}
+	if n := simulatorFrames(t, s); n != 4 {
+		t.Errorf("painted %d frames, want the 4 of the cycle", n)
+	}
+}
+
+// display.tricolor on a panel without red leaves the other modes to apply.
+func TestTricolorWithoutRed(t *testing.T) {
+	withDisplayConfig(t)
+	DISPLAY_TRICOLOR = true
+	s := newTestSimulator(t)
+	img := image.NewGray(s.Bounds())
+
+	DISPLAY_MODE = "fast"
+	if err := displayImage("abc", img, s); err != nil {
+		t.Fatal(err)
+	}
+	if STATE.FastUpdates != 1 {
+		t.Errorf("fast updates = %d, want a fast refresh", STATE.FastUpdates)
+	}
+
+	DISPLAY_GRAYSCALE = true
+	if err := displayImage("abc", img, s); err != nil {
+		t.Fatal(err)
+	}
+	if want := frameHash(s.Convert4Gray(img)); STATE.Frame != want {
+		t.Error("frame on display is not the greyscale one")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"tsmith512/epd7in5v2"
+)
+
+// Simulator stands in for the panel on development machines. It runs images
+// through the same conversion as the real display and writes the resulting
+// 1-bit frame out as a PNG, so rendering can be checked without a Pi.
+type Simulator struct {
+	dir   string
+	label string
+	panel *epd7in5v2.Panel
+	opts  epd7in5v2.Options
+	frame []byte
+	count int // Frames written, to keep names unique within a second
+}
+
+// Set up a simulator of panel that saves frames into dir, creating it if
+// needed.
+func newSimulator(dir string, panel *epd7in5v2.Panel, opts epd7in5v2.Options) (*Simulator, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Simulating %s: frames will be written to %s", panel.Name, dir)
+	return &Simulator{dir: dir, panel: panel, opts: opts}, nil
+}
+
+// Name the next frame after this image ID.
+func (s *Simulator) SetLabel(label string) {
+	s.label = label
+}
+
+func (s *Simulator) Init(ctx context.Context) error {
+	return nil
+}
+
+func (s *Simulator) Reset() error {
+	return nil
+}
+
+func (s *Simulator) Sleep(ctx context.Context) error {
+	return nil
+}
+
+func (s *Simulator) Close() error {
+	return nil
+}
+
+func (s *Simulator) Bounds() image.Rectangle {
+	return s.panel.Bounds()
+}
+
+// Offer the same features as the panel being simulated.
+func (s *Simulator) Supports(f epd7in5v2.Feature) bool {
+	return s.panel.Supports(f)
+}
+
+// Convert the image exactly as the panel would receive it.
+func (s *Simulator) Frame(img image.Image) []byte {
+	s.frame = s.panel.ConvertInto(s.frame, img, s.opts)
+	return s.frame
+}
+
+// Save a frame from Frame.
+func (s *Simulator) Display(ctx context.Context, frame []byte) error {
+	return s.write(s.panel.Unpack(frame), s.label)
+}
+
+func (s *Simulator) InitFast(ctx context.Context) error {
+	return nil
+}
+
+func (s *Simulator) Init4Gray(ctx context.Context) error {
+	return nil
+}
+
+// Convert the image to four tones as the panel would receive it.
+func (s *Simulator) Convert4Gray(img image.Image) (oldData, newData []byte) {
+	return s.panel.Convert4Gray(img, s.opts)
+}
+
+// Save a pair of buffers from Convert4Gray.
+func (s *Simulator) Display4Gray(ctx context.Context, oldData, newData []byte) error {
+	return s.write(s.panel.Unpack4Gray(oldData, newData), s.label)
+}
+
+// Convert the image to black, white and red as the panel would receive it.
+func (s *Simulator) Convert3Color(img image.Image) (black, red []byte) {
+	return s.panel.Convert3Color(img, s.opts)
+}
+
+// Save a pair of planes from Convert3Color.
+func (s *Simulator) Display3Color(ctx context.Context, black, red []byte) error {
+	return s.write(s.panel.Unpack3Color(black, red), s.label)
+}
+
+// Save each step of the driver's anti-ghosting cycle, ending on a frame from
+// Frame.
+func (s *Simulator) DeepCleanFrame(ctx context.Context, frame []byte) error {
+	steps := []string{"clean-black", "clean-white", "clean-negative", s.label}
+
+	for i, f := range epd7in5v2.CleanFrames(frame) {
+		if err := s.write(s.panel.Unpack(f), steps[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save a blank frame.
+func (s *Simulator) Clear(ctx context.Context) error {
+	return s.write(s.panel.Unpack(s.panel.Blank()), "clear")
+}
+
+// Write a frame to "<timestamp>-<count>-<label>.png" in the output directory.
+func (s *Simulator) write(frame image.Image, label string) error {
+	if label == "" {
+		label = "frame"
+	}
+
+	// Image IDs come from the API; keep them from reaching outside the directory
+	label = strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(label)
+
+	s.count++
+	name := fmt.Sprintf("%s-%04d-%s.png", time.Now().Format("20060102-150405"), s.count, label)
+	path := filepath.Join(s.dir, name)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Simulator could not create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, frame); err != nil {
+		return fmt.Errorf("Simulator could not write %s: %w", path, err)
+	}
+
+	log.Printf("Simulator wrote %s", path)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"tsmith512/epd7in5v2"
+)
+
+func newTestSimulator(t *testing.T) *Simulator {
+	t.Helper()
+
+	panel, err := epd7in5v2.LookupPanel("epd7in5v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newSimulator(t.TempDir(), panel, epd7in5v2.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSimulatorFramesInOneSecond(t *testing.T) {
+	s := newTestSimulator(t)
+	ctx := context.Background()
+
+	// The same image twice, as at the end of a deep clean and the repaint
+	// after it, well within a second
+	s.SetLabel("abc123")
+	for i := 0; i < 2; i++ {
+		if err := s.Display(ctx, s.panel.Blank()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("wrote %d files, want 2", len(files))
+	}
+}
+
+func TestSimulatorLabelWithSlash(t *testing.T) {
+	s := newTestSimulator(t)
+
+	s.SetLabel("2023/01/photo")
+	if err := s.Display(context.Background(), s.panel.Blank()); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("wrote %d files, want 1 in the output directory", len(files))
+	}
+	if name := files[0].Name(); !strings.HasSuffix(name, "-2023_01_photo.png") || !strings.HasPrefix(name, "20") {
+		t.Errorf("wrote %s, want a timestamped name ending in the whole label", name)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State is what the service remembers across restarts, saved as JSON in
+// STATE_FILE.
+type State struct {
+	// Image refreshes since the last deep clean
+	RefreshesSinceClean int `json:"refreshes_since_clean"`
+
+	// When the last deep clean ran
+	LastClean time.Time `json:"last_clean"`
+
+	// Deep cleans that have failed in a row, and when to try again (see
+	// cleanBackoff)
+	CleanFailures int       `json:"clean_failures"`
+	CleanRetryAt  time.Time `json:"clean_retry_at"`
+
+	// Fast refreshes since the last full one, see DISPLAY_FULL_REFRESH_EVERY
+	FastUpdates int `json:"fast_updates"`
+
+	// SHA-256 of the frame on screen, or empty if unknown (see frameHash)
+	Frame string `json:"frame"`
+}
+
+// Loaded at startup; saved whenever it changes.
+var STATE State
+
+// Read STATE_FILE into STATE. A missing file is a fresh start, not an error.
+func loadState() error {
+	data, err := os.ReadFile(STATE_FILE)
+	if errors.Is(err, os.ErrNotExist) {
+		if DEBUG {
+			log.Printf("No state file at %s: starting fresh", STATE_FILE)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &STATE)
+}
+
+// Write STATE to STATE_FILE. Failing to save isn't worth stopping for (the
+// CLI may be run as a user who can't write there), so this only logs.
+func saveState() {
+	data, err := json.MarshalIndent(STATE, "", "  ")
+	if err != nil {
+		log.Printf("Unable to encode state: %s", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(STATE_FILE), 0755); err != nil {
+		log.Printf("Unable to save state: %s", err)
+		return
+	}
+
+	// Write to a temporary file and rename it into place, so a power cut
+	// mid-write doesn't leave a truncated file behind
+	tmp := STATE_FILE + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("Unable to save state: %s", err)
+		return
+	}
+	if err := os.Rename(tmp, STATE_FILE); err != nil {
+		log.Printf("Unable to save state: %s", err)
+	}
+}